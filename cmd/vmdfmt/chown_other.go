@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"os"
+)
+
+// chown is not supported on this platform, so ownership is not preserved
+func chown(path string, fi os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown sets the owner and group of the file at path to those of fi
+func chown(path string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := os.Chown(path, int(st.Uid), int(st.Gid))
+	if os.IsPermission(err) {
+		// an unprivileged user cannot give a file away, so the
+		// replaced file is owned by them, as if it had been edited
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bobertlo/vmd/pkg/mdformatter"
+)
+
+// composeCommand implements "vmdfmt compose": it concatenates markdown files
+// into one formatted document on standard output.
+func composeCommand(args []string) int {
+	fs := flag.NewFlagSet("compose", flag.ExitOnError)
+	title := fs.String("title", "", "heading to nest every document under")
+	level := fs.Int("level", 1, "level of the title heading, or of the top headings of each document")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] compose [-title text] [-level n] path ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *level < 1 || *level > 6 {
+		fmt.Fprintln(os.Stderr, "error: -level must be 1 to 6")
+		return 2
+	}
+
+	err := composeFiles(fs.Args(), *title, *level, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// composeFiles writes the markdown files at paths to out as one document. If
+// title is not empty it is emitted as a heading at level, and the documents
+// are nested under it, otherwise their top headings are shifted to level.
+// Includes are expanded relative to the directory of each file.
+func composeFiles(paths []string, title string, level int, out io.Writer) error {
+	parts := []mdformatter.Part{}
+	if title != "" {
+		parts = append(parts, mdformatter.Part{Title: title, Level: level})
+		level++
+	}
+	for _, path := range paths {
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, mdformatter.Part{Level: level, Source: dat, IncludeDir: filepath.Dir(path)})
+	}
+
+	res, err := formatter().Compose(parts)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(res)
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// extractCommand implements "vmdfmt extract": it writes the section of a
+// markdown file under a heading path (i.e. "Changelog/1.4.0") to standard
+// output. A '/' in a heading is escaped as "\/".
+func extractCommand(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	level := fs.Int("level", 0, "shift headings so the section heading is at this level (0 keeps them)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] extract [-level n] section [path]")
+		fmt.Fprintln(os.Stderr, "section is a '/' separated heading path; write a '/' in a heading as '\\/'")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	if *level < 0 || *level > 6 {
+		fmt.Fprintln(os.Stderr, "error: -level must be 0 to 6")
+		return 2
+	}
+
+	path := ""
+	if fs.NArg() == 2 {
+		path = fs.Arg(1)
+	}
+	err := extractSection(fs.Arg(0), path, *level, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// extractSection writes the section under a '/' separated heading path (see
+// splitSection) of the markdown file at path (or stdin, if path is empty) to
+// out
+func extractSection(section, path string, level int, out io.Writer) error {
+	var input []byte
+	var err error
+	if path == "" {
+		input, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		input, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := fileFormatter(path).Extract(input, splitSection(section), level)
+	if err != nil {
+		if path != "" {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		return err
+	}
+	_, err = out.Write(res)
+	return err
+}
+
+// splitSection splits a heading path at each '/', except where it is escaped
+// as "\/" (a '/' in a heading)
+func splitSection(section string) []string {
+	path := []string{}
+	var heading strings.Builder
+	for i := 0; i < len(section); i++ {
+		switch {
+		case strings.HasPrefix(section[i:], `\/`):
+			heading.WriteByte('/')
+			i++
+		case section[i] == '/':
+			path = append(path, heading.String())
+			heading.Reset()
+		default:
+			heading.WriteByte(section[i])
+		}
+	}
+	return append(path, heading.String())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// git runs the git command line tool in dir, returning its standard output
+func git(dir string, args ...string) ([]byte, error) {
+	return gitInput(dir, nil, args...)
+}
+
+// gitInput runs the git command line tool in dir with input as its standard
+// input, returning its standard output
+func gitInput(dir string, input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return out, nil
+}
+
+// gitRoot returns the top level directory of the repository containing dir
+func gitRoot(dir string) (string, error) {
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitFiles runs a git command which lists NUL separated paths relative to
+// the repository root, and returns the markdown files among them as paths
+// joined to the root. Paths matching -exclude patterns are skipped.
+func gitFiles(dir string, args ...string) ([]string, error) {
+	root, err := gitRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := excludeMatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" || !hasMarkdownExt(name) || m.Match(name, false) {
+			continue
+		}
+		files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+	}
+	return files, nil
+}
+
+// changedFiles lists the markdown files which were added, copied, modified or
+// renamed in the working tree of the repository containing dir, compared to
+// ref (including staged and unstaged changes.)
+func changedFiles(dir, ref string) ([]string, error) {
+	return gitFiles(dir, "diff", "--name-only", "-z", "--diff-filter=ACMR", ref, "--")
+}
+
+// stagedFiles lists the markdown files with changes staged for commit in the
+// repository containing dir.
+func stagedFiles(dir string) ([]string, error) {
+	return gitFiles(dir, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR", "--")
+}
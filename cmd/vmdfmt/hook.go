@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker identifies pre-commit hooks written by "vmdfmt hook install"
+const hookMarker = "# installed by vmdfmt hook install"
+
+func hookUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] hook install [-f]")
+		fmt.Fprintln(os.Stderr, "       vmdfmt [flags] hook run")
+		fs.PrintDefaults()
+	}
+}
+
+// hookCommand implements "vmdfmt hook": "install" writes a git pre-commit
+// hook which runs "vmdfmt hook run", which formats the staged content of
+// each staged markdown file.
+func hookCommand(args []string) int {
+	fs := flag.NewFlagSet("hook", flag.ExitOnError)
+	force := fs.Bool("f", false, "overwrite an existing pre-commit hook")
+	fs.Usage = hookUsage(fs)
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	fs.Parse(args[1:])
+
+	var err error
+	switch args[0] {
+	case "install":
+		// pass the formatting flags given to this command on to the hook
+		flags := os.Args[1 : len(os.Args)-len(args)-1]
+		err = installHook(".", flags, *force, os.Stdout)
+	case "run":
+		err = runHook(".", os.Stdout)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// installHook writes a pre-commit hook to the git repository containing dir,
+// which runs "vmdfmt hook run" with flags. An existing hook which was not
+// written by vmdfmt is only replaced if force is set.
+func installHook(dir string, flags []string, force bool, out io.Writer) error {
+	hooks, err := git(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return err
+	}
+	hooksDir := strings.TrimSpace(string(hooks))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	path := filepath.Join(hooksDir, "pre-commit")
+
+	old, err := ioutil.ReadFile(path)
+	if err == nil && !force && !bytes.Contains(old, []byte(hookMarker)) {
+		return fmt.Errorf("%s already exists, use -f to replace it", path)
+	}
+
+	quoted := []string{"vmdfmt"}
+	for _, f := range flags {
+		quoted = append(quoted, "'"+strings.Replace(f, "'", `'\''`, -1)+"'")
+	}
+	script := "#!/bin/sh\n" + hookMarker + "\nexec " +
+		strings.Join(quoted, " ") + " hook run\n"
+
+	err = os.MkdirAll(hooksDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, []byte(script), 0755)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "installed %s\n", path)
+	return nil
+}
+
+// stagedBlob returns the mode and content of the staged version of path
+// (relative to the repository root)
+func stagedBlob(root, path string) (string, []byte, error) {
+	info, err := git(root, "ls-files", "-s", "--", path)
+	if err != nil {
+		return "", nil, err
+	}
+	fields := strings.Fields(string(info))
+	if len(fields) < 4 || fields[2] != "0" {
+		return "", nil, fmt.Errorf("%s: is not staged (or has merge conflicts)", path)
+	}
+
+	content, err := git(root, "cat-file", "blob", fields[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return fields[0], content, nil
+}
+
+// runHook formats the staged content of every staged markdown file in the
+// repository containing dir, and stages the formatted content. The working
+// tree file is updated to match, unless it has unstaged changes: then the
+// staged and working tree content cannot both be kept, so the hook aborts
+// before changing anything.
+func runHook(dir string, out io.Writer) error {
+	root, err := gitRoot(dir)
+	if err != nil {
+		return err
+	}
+	files, err := stagedFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	type update struct {
+		path, mode    string
+		input, output []byte
+		partial       bool
+	}
+	updates := []update{}
+
+	for _, f := range files {
+		path, err := filepath.Rel(root, f)
+		if err != nil {
+			return err
+		}
+		path = filepath.ToSlash(path)
+
+		mode, input, err := stagedBlob(root, path)
+		if err != nil {
+			return err
+		}
+		output, err := fileFormatter(f).RenderBytes(input)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if bytes.Equal(input, output) {
+			continue
+		}
+
+		unstaged, err := git(root, "diff", "--name-only", "--", path)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, update{path, mode, input, output, len(unstaged) > 0})
+	}
+
+	partial := []string{}
+	for _, u := range updates {
+		if u.partial {
+			partial = append(partial, u.path)
+		}
+	}
+	if len(partial) > 0 {
+		return errors.New("cannot format partially staged files: " +
+			strings.Join(partial, ", ") + "\n" +
+			"stage or stash their unstaged changes, or format them with vmdfmt -w")
+	}
+
+	for _, u := range updates {
+		err := stageContent(root, u.path, u.mode, u.output)
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(root, filepath.FromSlash(u.path)), u.input, u.output, "")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "vmdfmt: formatted %s\n", u.path)
+	}
+
+	return nil
+}
+
+// stageContent writes content as a blob and stages it for path
+func stageContent(root, path, mode string, content []byte) error {
+	blob, err := gitInput(root, content, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	info := mode + "," + strings.TrimSpace(string(blob)) + "," + path
+	_, err = git(root, "update-index", "--cacheinfo", info)
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bobertlo/vmd/internal/links"
+)
+
+// linksCommand implements "vmdfmt links": it checks the link and image
+// destinations of markdown files against the filesystem and the headings of
+// the documents they point to, and fails if any are broken.
+func linksCommand(args []string) int {
+	fs := flag.NewFlagSet("links", flag.ExitOnError)
+	root := fs.String("root", ".", "directory which absolute link paths are resolved against")
+	external := fs.Bool("external", false, "also request http and https links")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] links [-root dir] [-external] [path ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	c := links.NewChecker(*root)
+	c.IsMarkdown = hasMarkdownExt
+	if *external {
+		c.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	ok := true
+	check := func(path string) error {
+		broken, err := c.CheckFile(path)
+		for _, b := range broken {
+			fmt.Println(b)
+			ok = false
+		}
+		if err != nil {
+			ok = false
+		}
+		return err
+	}
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err == nil && fi.IsDir() {
+			err = walkMarkdown(path, check)
+		} else if err == nil {
+			err = check(path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 1
+		}
+	}
+
+	if !ok {
+		return 1
+	}
+	return 0
+}
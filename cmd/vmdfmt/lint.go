@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/bobertlo/vmd/pkg/lint"
+)
+
+// lintConfigFile is read from the current directory if -config is not given
+const lintConfigFile = ".vmdlint"
+
+// lintCommand implements "vmdfmt lint": it checks markdown files (or
+// stdin) against the lint rules, and fails if any issue with error severity
+// is found.
+func lintCommand(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	config := fs.String("config", "", "lint configuration file (default: "+lintConfigFile+" if present)")
+	rules := fs.Bool("rules", false, "list the built-in rules")
+	fix := fs.Bool("fix", false, "fix the issues of fixable rules, and write the formatted files")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] lint [-config file] [-fix] [path ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *rules {
+		for _, r := range lint.Rules() {
+			fmt.Printf("%-20s %s\n", r.Name(), r.Description())
+		}
+		return 0
+	}
+
+	c, err := lintConfig(*config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	l := lint.New(c)
+
+	failed := false
+	check := func(path string, in io.Reader) error {
+		ok, err := lintFile(l, path, in, os.Stdout, *fix)
+		if !ok {
+			failed = true
+		}
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		if *fix {
+			fmt.Fprintln(os.Stderr, "error: cannot use -fix when reading stdin")
+			return 1
+		}
+		err := check("<stdin>", os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 1
+		}
+	}
+	for _, path := range fs.Args() {
+		fi, err := os.Stat(path)
+		if err == nil && fi.IsDir() {
+			err = walkMarkdown(path, func(path string) error {
+				return check(path, nil)
+			})
+		} else if err == nil {
+			err = check(path, nil)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 1
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// lintConfig loads the lint configuration from path, or from lintConfigFile
+// if path is empty and it exists
+func lintConfig(path string) (lint.Config, error) {
+	if path == "" {
+		if _, err := os.Stat(lintConfigFile); err != nil {
+			return lint.Config{Cols: *cols}, nil
+		}
+		path = lintConfigFile
+	}
+	c, err := lint.LoadConfig(path)
+	if err != nil {
+		return c, fmt.Errorf("%s: %s", path, err)
+	}
+	c.Cols = *cols
+	return c, nil
+}
+
+// lintFile lints a file (read from in, if it is not nil), printing each issue
+// to out. If fix is set, the fixes of fixable rules are applied first, and
+// the formatted file is written back. Returns false if an issue with error
+// severity was found.
+func lintFile(l *lint.Linter, path string, in io.Reader, out io.Writer, fix bool) (bool, error) {
+	var input []byte
+	var err error
+	if in == nil {
+		input, err = ioutil.ReadFile(path)
+	} else {
+		input, err = ioutil.ReadAll(in)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if fix {
+		output, fixes, err := l.Fix(input, fileOptions(path))
+		if err != nil {
+			return false, fmt.Errorf("%s: %s", path, err)
+		}
+		for _, f := range fixes {
+			fmt.Fprintf(out, "%s:%d: fixed: %s [%s]\n", path, f.Line, f.Message, f.Rule)
+		}
+		if !bytes.Equal(input, output) {
+			err = writeFile(path, input, output, *backup)
+			if err != nil {
+				return false, err
+			}
+		}
+		input = output
+	}
+
+	issues, err := l.Lint(input)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", path, err)
+	}
+
+	ok := true
+	for _, i := range issues {
+		fmt.Fprintf(out, "%s:%s\n", path, i)
+		if i.Severity == lint.Error {
+			ok = false
+		}
+	}
+	return ok, nil
+}
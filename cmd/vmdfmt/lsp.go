@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bobertlo/vmd/internal/lsp"
+)
+
+// lspCommand implements "vmdfmt lsp": a language server on stdin and stdout,
+// which formats documents with the formatting flags given to this command.
+// Includes are expanded relative to the directory of each document.
+func lspCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] lsp")
+		return 2
+	}
+
+	err := lsp.NewServer(formatOptions(), os.Stdin, os.Stdout).Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
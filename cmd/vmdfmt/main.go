@@ -2,14 +2,17 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/bobertlo/vmd/internal/ignore"
 	"github.com/bobertlo/vmd/pkg/mdformatter"
 )
 
@@ -17,27 +20,170 @@ var (
 	cols  = flag.Int("cols", 80, "number of columns to wrap output")
 	write = flag.Bool("w", false, "write changes to (source) file")
 	list  = flag.Bool("l", false, "list files with modifications")
+
+	backup = flag.String("backup", "", "with -w, save the original of each changed file with this suffix")
+
+	explain = flag.Bool("explain", false, "list the normalizations applied to each file")
+	lines   = flag.String("lines", "", "only format the top level blocks intersecting a line range (first:last)")
+
+	sortFrontMatter = flag.Bool("sort-frontmatter", false, "sort top level front matter keys")
+	headingIDs      = flag.Bool("heading-ids", false, "pin a generated {#id} on every heading")
+	checkAnchors    = flag.Bool("check-anchors", false, "fail on in-document links to missing headings")
+	listDelimiter   = flag.String("delim", ".", "delimiter after ordered list numbers: '.' or ')'")
+	uniformNumbers  = flag.Bool("uniform-numbers", false, "number every ordered list item with the list's start number")
+	calloutTypes    = flag.String("callouts", "", "comma separated list of accepted block quote callout types")
+	tocDepth        = flag.Int("toc-depth", 3, "deepest heading level listed in a table of contents")
+	anchorStyle     = flag.String("anchor-style", "github", "heading anchor style: 'github' or 'gitlab'")
+
+	extensions = flag.String("ext", ".md", "comma separated list of markdown file extensions")
+	gitignore  = flag.Bool("gitignore", false, "skip files ignored by .gitignore files")
+	exclude    stringList
+
+	rewriteRules stringList
+	rewrites     []mdformatter.Rewrite
+
+	gitChanged = flag.Bool("git-changed", false, "format markdown files changed in git compared to a ref (default: HEAD)")
+	staged     = flag.Bool("staged", false, "format markdown files with changes staged in git")
 )
 
+// lineRange holds the first and last line of the -lines flag
+var lineRange [2]int
+
+// parseLineRange parses a "first:last" line range, counting from 1
+func parseLineRange(s string) ([2]int, error) {
+	var r [2]int
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return r, fmt.Errorf("invalid line range %q, expected first:last", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			return r, fmt.Errorf("invalid line number %q in line range", p)
+		}
+		r[i] = n
+	}
+	if r[0] > r[1] {
+		return r, fmt.Errorf("invalid line range %q, first line is after last", s)
+	}
+	return r, nil
+}
+
+// ignoreFile is read from every directory walked, with gitignore semantics
+const ignoreFile = ".vmdignore"
+
+// vcsDirs are never walked
+var vcsDirs = map[string]bool{".git": true, ".hg": true, ".svn": true}
+
+func init() {
+	flag.Var(&exclude, "exclude", "skip files and directories matching a glob (may be repeated)")
+	flag.Var(&rewriteRules, "r", "rewrite rule 'kind:pattern -> replacement' (may be repeated)")
+}
+
+// stringList is a flag which may be given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// commands are run when their name is the first argument after the flags.
+// They are passed the remaining arguments, and return an exit status.
+var commands = map[string]func(args []string) int{
+	"compose": composeCommand,
+	"extract": extractCommand,
+	"hook":    hookCommand,
+	"lint":    lintCommand,
+	"links":   linksCommand,
+	"lsp":     lspCommand,
+	"mv":      mvCommand,
+	"split":   splitCommand,
+}
+
+// command returns the command named by the first of args, the arguments
+// left after the flags. A first argument naming an existing file or directory
+// is a path to format instead, as are all of args if paths is set.
+func command(args []string, paths bool) (func(args []string) int, bool) {
+	if len(args) == 0 || paths {
+		return nil, false
+	}
+	if _, err := os.Stat(args[0]); err == nil {
+		return nil, false
+	}
+	cmd, ok := commands[args[0]]
+	return cmd, ok
+}
+
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] [path ...]")
+	fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] [--] [path ...]")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] -git-changed [ref]")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] -staged")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] compose [-title text] [-level n] path ...")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] extract [-level n] section [path]")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] hook install|run")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] lint [-config file] [-fix] [path ...]")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] links [-root dir] [-external] [path ...]")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] lsp")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] mv [-root dir] old new")
+	fmt.Fprintln(os.Stderr, "       vmdfmt [flags] split [-level n] path")
 	flag.PrintDefaults()
 }
 
+// formatter returns an MDFormatter configured by the formatting flags
+func formatter() *mdformatter.MDFormatter {
+	return mdformatter.NewOptions(formatOptions())
+}
+
+// fileFormatter returns an MDFormatter configured by the formatting flags for
+// the file at path
+func fileFormatter(path string) *mdformatter.MDFormatter {
+	return mdformatter.NewOptions(fileOptions(path))
+}
+
+// formatOptions returns the Options set by the formatting flags
+func formatOptions() mdformatter.Options {
+	var callouts []string
+	if *calloutTypes != "" {
+		callouts = strings.Split(*calloutTypes, ",")
+	}
+
+	return mdformatter.Options{
+		Cols:            *cols,
+		SortFrontMatter: *sortFrontMatter,
+		HeadingIDs:      *headingIDs,
+		CheckAnchors:    *checkAnchors,
+
+		ListDelimiter:    (*listDelimiter)[0],
+		UniformNumbering: *uniformNumbers,
+		CalloutTypes:     callouts,
+		Rewrites:         rewrites,
+
+		TOCDepth:    *tocDepth,
+		AnchorStyle: *anchorStyle,
+	}
+}
+
+// fileOptions returns the Options set by the formatting flags for the file
+// at path, whose include directives are resolved against its directory
+func fileOptions(path string) mdformatter.Options {
+	opts := formatOptions()
+	opts.IncludeDir = filepath.Dir(path)
+	return opts
+}
+
 func processFile(path string, in io.Reader, out io.Writer) error {
-	var perm os.FileMode = 0644
 	if in == nil {
 		f, err := os.Open(path)
 		if err != nil {
 			return err
 		}
 		defer f.Close()
-		fi, err := f.Stat()
-		if err != nil {
-			return err
-		}
 		in = f
-		perm = fi.Mode().Perm()
 	}
 
 	input, err := ioutil.ReadAll(in)
@@ -45,8 +191,13 @@ func processFile(path string, in io.Reader, out io.Writer) error {
 		return err
 	}
 
-	md := mdformatter.New(*cols)
-	output, err := md.RenderBytes(input)
+	md := fileFormatter(path)
+	var output []byte
+	if *lines != "" {
+		output, err = md.RenderRange(input, lineRange[0], lineRange[1])
+	} else {
+		output, err = md.RenderBytes(input)
+	}
 	if err != nil {
 		return err
 	}
@@ -55,48 +206,210 @@ func processFile(path string, in io.Reader, out io.Writer) error {
 		if *list {
 			fmt.Fprintln(out, path)
 		}
+		if *explain {
+			explainFile(path, md.Explain(input), out)
+		}
 		if *write {
-			err = ioutil.WriteFile(path, output, perm)
+			err = writeFile(path, input, output, *backup)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	if !*write && !*list {
+	if !*write && !*list && !*explain {
 		out.Write(output)
 	}
 
 	return nil
 }
 
+// explainFile prints the normalizations applied to a file, grouped by rule
+func explainFile(path string, changes []mdformatter.Normalization, out io.Writer) {
+	fmt.Fprintf(out, "%s:\n", path)
+	for _, rule := range mdformatter.Rules {
+		header := false
+		for _, c := range changes {
+			if c.Rule != rule {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(out, "  %s:\n", rule)
+				header = true
+			}
+			fmt.Fprintf(out, "    %d: %s\n", c.Line, c.Message)
+		}
+	}
+}
+
 func isMarkdownFile(f os.FileInfo) bool {
 	if f.IsDir() {
 		return false
 	}
-	return strings.HasSuffix(f.Name(), ".md")
+	return hasMarkdownExt(f.Name())
+}
+
+// hasMarkdownExt reports whether name ends with one of the -ext extensions
+func hasMarkdownExt(name string) bool {
+	for _, ext := range strings.Split(*extensions, ",") {
+		if ext != "" && strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeMatcher returns a Matcher for the -exclude patterns
+func excludeMatcher() (*ignore.Matcher, error) {
+	m := ignore.New()
+	for _, p := range exclude {
+		err := m.Add("", p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// walkDir processes every markdown file under root, writing output to out
+func walkDir(root string, out io.Writer) error {
+	return walkMarkdown(root, func(path string) error {
+		return processFile(path, nil, out)
+	})
 }
 
-func walkFile(path string, f os.FileInfo, err error) error {
+// walkMarkdown calls fn for every markdown file under root, printing any
+// errors it returns. VCS directories are skipped, as are paths matched by
+// -exclude patterns or by the ignore files found in each directory.
+func walkMarkdown(root string, fn func(path string) error) error {
+	m, err := excludeMatcher()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
 	}
 
-	if isMarkdownFile(f) {
-		err := processFile(path, nil, os.Stdout)
+	return filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if f.IsDir() {
+			if rel != "." && (vcsDirs[f.Name()] || m.Match(rel, true)) {
+				return filepath.SkipDir
+			}
+			return loadIgnoreFiles(m, rel, path)
+		}
+
+		if isMarkdownFile(f) && !m.Match(rel, false) {
+			err := fn(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// loadIgnoreFiles adds the patterns of the ignore files in dir (which is rel
+// relative to the walk root) to m
+func loadIgnoreFiles(m *ignore.Matcher, rel, dir string) error {
+	if rel == "." {
+		rel = ""
+	}
+	err := m.AddFile(rel, filepath.Join(dir, ignoreFile))
+	if err != nil || !*gitignore {
+		return err
+	}
+	return m.AddFile(rel, filepath.Join(dir, ".gitignore"))
+}
+
+// processGitFiles processes the markdown files changed in the git repository
+// containing the current directory, for the -git-changed and -staged modes
+func processGitFiles() {
+	var files []string
+	var err error
+	if *staged {
+		files, err = stagedFiles(".")
+	} else {
+		ref := "HEAD"
+		if flag.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, "error: -git-changed takes a single ref")
+			os.Exit(1)
+		} else if flag.NArg() == 1 {
+			ref = flag.Arg(0)
 		}
+		files, err = changedFiles(".", ref)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
 	}
 
-	return nil
+	for _, f := range files {
+		err := processFile(f, nil, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", f, err)
+			os.Exit(1)
+		}
+	}
 }
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
 
+	if *listDelimiter != "." && *listDelimiter != ")" {
+		fmt.Fprintln(os.Stderr, "error: -delim must be '.' or ')'")
+		os.Exit(1)
+	}
+	if *anchorStyle != mdformatter.AnchorGitHub && *anchorStyle != mdformatter.AnchorGitLab {
+		fmt.Fprintln(os.Stderr, "error: -anchor-style must be 'github' or 'gitlab'")
+		os.Exit(1)
+	}
+	if *tocDepth < 1 || *tocDepth > 6 {
+		fmt.Fprintln(os.Stderr, "error: -toc-depth must be 1 to 6")
+		os.Exit(1)
+	}
+
+	for _, rule := range rewriteRules {
+		rw, err := mdformatter.ParseRewrite(rule)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		rewrites = append(rewrites, rw)
+	}
+
+	if *lines != "" {
+		var err error
+		lineRange, err = parseLineRange(*lines)
+		if err == nil && (flag.NArg() > 1 || *gitChanged || *staged) {
+			err = errors.New("-lines can only be used with a single file")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// the arguments after "--" are paths, even if named like a command
+	paths := flag.NArg() > 0 && os.Args[len(os.Args)-flag.NArg()-1] == "--"
+	if cmd, ok := command(flag.Args(), paths); ok {
+		os.Exit(cmd(flag.Args()[1:]))
+	}
+
+	if *gitChanged || *staged {
+		processGitFiles()
+		return
+	}
+
 	if flag.NArg() == 0 {
 		if *write {
 			fmt.Fprintln(os.Stderr, "error: cannot use -w when reading stdin")
@@ -116,7 +429,15 @@ func main() {
 			os.Exit(1)
 		}
 		if dir.IsDir() {
-			filepath.Walk(f, walkFile)
+			if *lines != "" {
+				fmt.Fprintln(os.Stderr, "error: -lines can only be used with a single file")
+				os.Exit(1)
+			}
+			err := walkDir(f, os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
+				os.Exit(1)
+			}
 		} else {
 			err := processFile(f, nil, os.Stdout)
 			if err != nil {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bobertlo/vmd/internal/links"
+)
+
+// mvCommand implements "vmdfmt mv": it moves a file, and rewrites the
+// relative links to and from it in the markdown files under the root.
+func mvCommand(args []string) int {
+	fs := flag.NewFlagSet("mv", flag.ExitOnError)
+	root := fs.String("root", ".", "directory of the markdown files to rewrite links in")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] mv [-root dir] old new")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	err := moveFile(*root, fs.Arg(0), fs.Arg(1), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// moveFile moves the file from to the path to (or into it, if it is a
+// directory). The link destinations of every markdown file under root which
+// are affected by the move are rewritten, and those files are formatted. No
+// files are changed if any of them cannot be formatted.
+func moveFile(root, from, to string, out io.Writer) error {
+	fi, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s: can only move files", from)
+	}
+	if fi, err := os.Stat(to); err == nil && fi.IsDir() {
+		to = filepath.Join(to, filepath.Base(from))
+	}
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+
+	m, err := links.NewMove(root, from, to)
+	if err != nil {
+		return err
+	}
+
+	type update struct {
+		path          string
+		input, output []byte
+	}
+	updates := []update{}
+	var failed error
+	err = walkMarkdown(root, func(path string) error {
+		input, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		output, changed, err := m.Rewrite(path, input, fileOptions(path))
+		if !changed {
+			return nil
+		}
+		if err != nil {
+			failed = fmt.Errorf("%s: %s", path, err)
+			return nil
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if abs == m.Old {
+			path = to
+		}
+		updates = append(updates, update{path, input, output})
+		return nil
+	})
+	if err == nil {
+		err = failed
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(from, to)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "moved %s to %s\n", from, to)
+
+	for _, u := range updates {
+		err := writeFile(u.path, u.input, u.output, "")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rewrote links in %s\n", u.path)
+	}
+	return nil
+}
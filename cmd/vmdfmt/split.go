@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// splitCommand implements "vmdfmt split": it cuts a markdown file into a file
+// per section, and replaces it with an index linking to them.
+func splitCommand(args []string) int {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	level := fs.Int("level", 2, "level of the headings to split at")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vmdfmt [flags] split [-level n] path")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *level < 1 || *level > 6 {
+		fmt.Fprintln(os.Stderr, "error: -level must be 1 to 6")
+		return 2
+	}
+
+	err := splitFile(fs.Arg(0), *level, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// splitFile cuts the markdown file at path at its headings of level, writing
+// each section to a new file in the same directory and replacing the file with
+// an index of them. If any section file already exists, or a file cannot be
+// written, the section files written so far are removed.
+func splitFile(path string, level int, out io.Writer) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	index, files, err := fileFormatter(path).Split(input, filepath.Base(path), level)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	written := []string{}
+	fail := func(err error) error {
+		for _, p := range written {
+			os.Remove(p)
+		}
+		return err
+	}
+	for _, f := range files {
+		p := filepath.Join(filepath.Dir(path), f.Name)
+		err := createFile(p, f.Content, fi.Mode().Perm())
+		if err != nil {
+			return fail(err)
+		}
+		written = append(written, p)
+	}
+
+	err = writeFile(path, input, index, *backup)
+	if err != nil {
+		return fail(err)
+	}
+	for _, p := range written {
+		fmt.Fprintf(out, "wrote %s\n", p)
+	}
+	fmt.Fprintf(out, "rewrote %s as an index\n", path)
+	return nil
+}
+
+// createFile writes dat to a new file at path, failing if it already exists
+func createFile(path string, dat []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(dat)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
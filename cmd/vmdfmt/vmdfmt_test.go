@@ -4,7 +4,12 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/bobertlo/vmd/pkg/lint"
 )
 
 func TestIsMarkdown(t *testing.T) {
@@ -40,3 +45,476 @@ func TestProcessFile(t *testing.T) {
 		t.Error("file mismatch")
 	}
 }
+
+// writeTree writes files, a map of slash separated paths to their content,
+// to a temporary directory which is removed when the test ends, and returns
+// the directory
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWalkDir(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.md":                    "unformatted   file\n",
+		"b.markdown":              "unformatted   file\n",
+		"vendor/c.md":             "unformatted   file\n",
+		"docs/d.md":               "unformatted   file\n",
+		"docs/e.md":               "unformatted   file\n",
+		"docs/" + ignoreFile:      "e.md\n",
+		"node_modules/f.md":       "unformatted   file\n",
+		".git/g.md":               "unformatted   file\n",
+		ignoreFile:                "node_modules/\n",
+		"formatted/h.md":          "formatted file\n",
+		"docs/sub/ignored.tmp.md": "unformatted   file\n",
+	})
+
+	*list = true
+	*extensions = ".md,.markdown"
+	exclude = stringList{"vendor", "*.tmp.md"}
+	defer func() {
+		*list = false
+		*extensions = ".md"
+		exclude = nil
+	}()
+
+	out := bytes.NewBuffer(nil)
+	err := walkDir(dir, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		filepath.Join(dir, "a.md"),
+		filepath.Join(dir, "b.markdown"),
+		filepath.Join(dir, "docs", "d.md"),
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Errorf("invalid files walked:\n%s", out.String())
+	}
+}
+
+func TestGitFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := writeTree(t, nil)
+
+	run := func(args ...string) {
+		_, err := git(dir, append([]string{"-c", "user.name=vmd",
+			"-c", "user.email=vmd@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q")
+	write("committed.md", "one\n")
+	write("unchanged.md", "one\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+
+	write("committed.md", "two\n")
+	write("staged.md", "one\n")
+	write("notes.txt", "one\n")
+	run("add", "staged.md", "notes.txt")
+
+	root, err := gitRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := stagedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != filepath.Join(root, "staged.md") {
+		t.Errorf("invalid staged files: %v", files)
+	}
+
+	files, err = changedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != filepath.Join(root, "committed.md") ||
+		files[1] != filepath.Join(root, "staged.md") {
+		t.Errorf("invalid changed files: %v", files)
+	}
+
+	_, err = changedFiles(dir, "no-such-ref")
+	if err == nil {
+		t.Error("invalid ref accepted")
+	}
+}
+
+func TestHook(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := writeTree(t, nil)
+
+	run := func(args ...string) string {
+		out, err := git(dir, append([]string{"-c", "user.name=vmd",
+			"-c", "user.email=vmd@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		dat, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(dat)
+	}
+
+	run("init", "-q")
+	out := bytes.NewBuffer(nil)
+	err := installHook(dir, []string{"-cols", "60"}, false, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(read(".git/hooks/pre-commit"), "vmdfmt '-cols' '60' hook run") {
+		t.Error("invalid hook script")
+	}
+	write(".git/hooks/pre-commit", "#!/bin/sh\n")
+	if installHook(dir, nil, false, out) == nil {
+		t.Error("existing hook replaced without -f")
+	}
+	os.Remove(filepath.Join(dir, ".git/hooks/pre-commit"))
+
+	// a fully staged file is formatted in the index and the working tree
+	write("a.md", "unformatted   text\n")
+	run("add", "a.md")
+	err = runHook(dir, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run("show", ":a.md") != "unformatted text\n" || read("a.md") != "unformatted text\n" {
+		t.Error("staged file not formatted")
+	}
+	run("commit", "-q", "-m", "a")
+
+	// a partially staged file is not safe to format
+	write("a.md", "staged   text\n")
+	run("add", "a.md")
+	write("a.md", "unstaged   text\n")
+	err = runHook(dir, out)
+	if err == nil || !strings.Contains(err.Error(), "partially staged") {
+		t.Errorf("partially staged file not detected: %v", err)
+	}
+	if run("show", ":a.md") != "staged   text\n" || read("a.md") != "unstaged   text\n" {
+		t.Error("partially staged file modified")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := writeTree(t, nil)
+
+	path := filepath.Join(dir, "a.md")
+	err := ioutil.WriteFile(path, []byte("old\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(path, []byte("old\n"), []byte("new\n"), ".orig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(path)
+	if string(got) != "new\n" {
+		t.Errorf("file not written: %q", got)
+	}
+	got, _ = ioutil.ReadFile(path + ".orig")
+	if string(got) != "old\n" {
+		t.Errorf("backup not written: %q", got)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode not preserved: %s", fi.Mode())
+	}
+
+	err = writeFile(path, []byte("old\n"), []byte("newer\n"), "")
+	if err == nil || !strings.Contains(err.Error(), "changed on disk") {
+		t.Errorf("expected changed on disk error, got %v", err)
+	}
+	got, _ = ioutil.ReadFile(path)
+	if string(got) != "new\n" {
+		t.Errorf("changed file was overwritten: %q", got)
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+	dir := writeTree(t, map[string]string{"docs/README.md": "old\n"})
+
+	target := filepath.Join(dir, "docs", "README.md")
+	link := filepath.Join(dir, "README.md")
+	err := os.Symlink(filepath.Join("docs", "README.md"), link)
+	if err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+
+	err = writeFile(link, []byte("old\n"), []byte("new\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink replaced (%v)", err)
+	}
+	got, _ := ioutil.ReadFile(target)
+	if string(got) != "new\n" {
+		t.Errorf("symlink target not written: %q", got)
+	}
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, "docs"))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+}
+
+func TestLintFile(t *testing.T) {
+	l := lint.New(lint.Config{Rules: map[string]lint.Severity{"duplicate-heading": lint.Error}})
+
+	var out bytes.Buffer
+	ok, err := lintFile(l, "a.md", strings.NewReader("# One\n\n### Two\n"), &out, false)
+	if err != nil || !ok {
+		t.Errorf("lintFile failed: %v", err)
+	}
+	if out.String() != "a.md:3: warning: heading level skips from h1 to h3 [heading-increment]\n" {
+		t.Errorf("invalid lint output: %q", out.String())
+	}
+
+	out.Reset()
+	ok, err = lintFile(l, "b.md", strings.NewReader("# One\n\n# One\n"), &out, false)
+	if err != nil || ok {
+		t.Error("lintFile did not fail on an error severity issue")
+	}
+}
+
+func TestLintFix(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.md": "# One\n\n### Two:\n\n# One\n"})
+	path := filepath.Join(dir, "a.md")
+
+	var out bytes.Buffer
+	ok, err := lintFile(lint.New(lint.Config{}), path, nil, &out, true)
+	if err != nil || !ok {
+		t.Errorf("lintFile failed: %v", err)
+	}
+	expected := path + ":3: fixed: changed h3 to h2 [heading-increment]\n" +
+		path + ":3: fixed: removed ':' from the end of a heading [heading-punctuation]\n" +
+		path + ":5: warning: duplicate heading 'One' (first on line 1) [duplicate-heading]\n"
+	if out.String() != expected {
+		t.Errorf("invalid lint output: %q", out.String())
+	}
+
+	got, _ := ioutil.ReadFile(path)
+	if string(got) != "# One\n\n## Two\n\n# One\n" {
+		t.Errorf("fixed file not written: %q", got)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"README.md":         "See [setup](docs/a/setup.md).\n",
+		"docs/a/setup.md":   "# Setup\n\nBack to [the readme](../../README.md).\n",
+		"docs/unrelated.md": "unformatted   file\n",
+	})
+
+	var out bytes.Buffer
+	from := filepath.Join(dir, "docs", "a", "setup.md")
+	err := moveFile(dir, from, filepath.Join(dir, "docs"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"README.md":         "See [setup](docs/setup.md).\n",
+		"docs/setup.md":     "# Setup\n\nBack to [the readme](../README.md).\n",
+		"docs/unrelated.md": "unformatted   file\n",
+	}
+	for name, content := range expected {
+		got, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("%s: invalid content %q (%v)", name, got, err)
+		}
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Error("moved file still exists")
+	}
+
+	err = moveFile(dir, filepath.Join(dir, "README.md"), filepath.Join(dir, "docs", "setup.md"), &out)
+	if err == nil {
+		t.Error("moved over an existing file")
+	}
+}
+
+func TestComposeFiles(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.md":         "# Install\n\nrun   it\n",
+		"docs/b.md":    "Intro.\n\n<!-- include: note.md -->\n\n### Usage\n",
+		"docs/note.md": "A note.\n",
+	})
+	a := filepath.Join(dir, "a.md")
+	b := filepath.Join(dir, "docs", "b.md")
+
+	var out bytes.Buffer
+	err := composeFiles([]string{a, b}, "Guide", 1, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# Guide\n\n## Install\n\nrun it\n\nIntro.\n\n<!-- include: note.md -->\n\nA note.\n\n" +
+		"<!-- include-end -->\n\n## Usage\n"
+	if out.String() != expected {
+		t.Errorf("invalid composition:\n%s", out.String())
+	}
+
+	if composeFiles([]string{filepath.Join(dir, "missing.md")}, "", 1, &out) == nil {
+		t.Error("composed a missing file")
+	}
+}
+
+func TestProcessFileIncludes(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"license.md": "MIT licensed.\n",
+		"README.md":  "<!-- include: license.md -->\n\nMIT licensed.\n\n<!-- include-end -->\n",
+	})
+	doc := filepath.Join(dir, "README.md")
+
+	*list = true
+	defer func() { *list = false }()
+
+	var out bytes.Buffer
+	err := processFile(doc, nil, &out)
+	if err != nil || out.Len() != 0 {
+		t.Errorf("up to date include listed (%v): %s", err, out.String())
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "license.md"), []byte("Apache licensed.\n"), 0644)
+	err = processFile(doc, nil, &out)
+	if err != nil || out.String() != doc+"\n" {
+		t.Errorf("stale include not listed (%v): %s", err, out.String())
+	}
+}
+
+func TestExtractSection(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"CHANGELOG.md": "# Changelog\n\n## 1.4.0\n\n* New.\n\n## 1.3.0\n\n* Old.\n",
+	})
+	doc := filepath.Join(dir, "CHANGELOG.md")
+
+	var out bytes.Buffer
+	err := extractSection("Changelog/1.4.0", doc, 1, &out)
+	if err != nil || out.String() != "# 1.4.0\n\n- New.\n" {
+		t.Errorf("invalid section (%v):\n%s", err, out.String())
+	}
+
+	err = extractSection("Changelog/1.5.0", doc, 0, &out)
+	if err == nil {
+		t.Error("missing section extracted")
+	}
+
+	out.Reset()
+	ioutil.WriteFile(doc, []byte("# Changelog\n\n## 1.4.0/1.4.1\n\n* New.\n"), 0644)
+	err = extractSection(`Changelog/1.4.0\/1.4.1`, doc, 0, &out)
+	if err != nil || out.String() != "## 1.4.0/1.4.1\n\n- New.\n" {
+		t.Errorf("invalid escaped section (%v):\n%s", err, out.String())
+	}
+}
+
+func TestSplitFile(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"spec.md": "# Spec\n\n## Syntax\n\nSee [the api](#api).\n\n## API\n\nText.\n",
+	})
+	doc := filepath.Join(dir, "spec.md")
+
+	var out bytes.Buffer
+	err := splitFile(doc, 2, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"spec.md":   "# Spec\n\n- [Syntax](syntax.md)\n- [API](api.md)\n",
+		"syntax.md": "# Syntax\n\nSee [the api](api.md).\n",
+		"api.md":    "# API\n\nText.\n",
+	}
+	for name, content := range expected {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != content {
+			t.Errorf("%s: invalid content %q (%v)", name, got, err)
+		}
+	}
+
+	src := []byte("# Spec\n\n## Intro\n\n## API\n")
+	ioutil.WriteFile(doc, src, 0644)
+	if splitFile(doc, 2, &out) == nil {
+		t.Error("split over an existing file")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "intro.md")); !os.IsNotExist(err) {
+		t.Errorf("section file left after a failed split (%v)", err)
+	}
+	if got, _ := ioutil.ReadFile(doc); string(got) != string(src) {
+		t.Errorf("file rewritten by a failed split:\n%s", got)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if _, ok := command([]string{"links", "a.md"}, false); !ok {
+		t.Error("links command not found")
+	}
+	if _, ok := command([]string{"links", "a.md"}, true); ok {
+		t.Error("path after -- run as a command")
+	}
+
+	// a directory named like a command is formatted
+	dir := writeTree(t, map[string]string{"links/docs/a.md": "unformatted   file\n"})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := command([]string{"links"}, false); ok {
+		t.Error("links directory run as a command")
+	}
+
+	*list = true
+	defer func() { *list = false }()
+	out := bytes.NewBuffer(nil)
+	if err := walkDir("links", out); err != nil || out.String() != filepath.Join("links", "docs", "a.md")+"\n" {
+		t.Errorf("invalid files walked (%v):\n%s", err, out.String())
+	}
+}
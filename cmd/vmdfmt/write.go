@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFile atomically replaces the file at path with output, by writing a
+// temporary file in the same directory and renaming it over the original.
+// The file must still contain input, otherwise it was changed since it was
+// read and the write is refused. If backup is not empty, the original content
+// is first saved to path+backup. The mode and (where supported) ownership of
+// the original file are preserved, and if path is a symlink the file it points
+// to is replaced, rather than the link.
+func writeFile(path string, input, output []byte, backup string) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, input) {
+		return fmt.Errorf("%s: file changed on disk, not writing", path)
+	}
+
+	if backup != "" {
+		err := ioutil.WriteFile(path+backup, input, fi.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+
+	dir, base := filepath.Split(target)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+base+".vmdfmt-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(output)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), fi.Mode())
+	if err != nil {
+		return err
+	}
+	err = chown(tmp.Name(), fi)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,145 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pattern is a single compiled gitignore pattern
+type pattern struct {
+	base    string // directory the pattern is relative to ("" for the root)
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher matches slash separated paths, relative to the root of a walk,
+// against gitignore style patterns. Patterns are matched in the order they
+// were added, and the last matching pattern decides.
+type Matcher struct {
+	patterns []pattern
+}
+
+// New creates an empty Matcher, which matches nothing
+func New() *Matcher {
+	return &Matcher{}
+}
+
+// globRegexp converts a gitignore glob into a regular expression
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Add adds a single gitignore pattern, relative to the directory base. Blank
+// lines and comments are ignored. Returns an error if the pattern is invalid.
+func (m *Matcher) Add(base, line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	p := pattern{base: strings.Trim(base, "/")}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	expr := globRegexp(strings.TrimPrefix(line, "/"))
+	if !strings.Contains(line, "/") {
+		// a pattern without a separator matches at any depth
+		expr = "(.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return err
+	}
+	p.re = re
+	m.patterns = append(m.patterns, p)
+	return nil
+}
+
+// AddFile adds every pattern in an ignore file, relative to the directory
+// base. A missing file is not an error.
+func (m *Matcher) AddFile(base, file string) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		err := m.Add(base, scanner.Text())
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Match reports whether the slash separated path (relative to the root) is
+// ignored. isDir specifies whether the path is a directory.
+func (m *Matcher) Match(name string, isDir bool) bool {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	ignored := false
+	for _, p := range m.patterns {
+		rel := name
+		if p.base != "" {
+			if !strings.HasPrefix(name, p.base+"/") {
+				continue
+			}
+			rel = name[len(p.base)+1:]
+		}
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
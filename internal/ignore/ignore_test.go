@@ -0,0 +1,38 @@
+package ignore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcher(t *testing.T) {
+	m := New()
+	for _, p := range []string{
+		"# comment",
+		"",
+		"vendor/",
+		"*.tmp.md",
+		"/CHANGES.md",
+		"docs/**/draft-*.md",
+		"!docs/**/draft-keep.md",
+	} {
+		assert.NoError(t, m.Add("", p))
+	}
+	assert.NoError(t, m.Add("sub", "local.md"))
+
+	assert.True(t, m.Match("vendor", true))
+	assert.True(t, m.Match("a/b/vendor", true))
+	assert.False(t, m.Match("vendor", false))
+	assert.True(t, m.Match("notes.tmp.md", false))
+	assert.True(t, m.Match("a/notes.tmp.md", false))
+	assert.True(t, m.Match("CHANGES.md", false))
+	assert.False(t, m.Match("a/CHANGES.md", false))
+	assert.True(t, m.Match("docs/draft-one.md", false))
+	assert.True(t, m.Match("docs/a/b/draft-two.md", false))
+	assert.False(t, m.Match("docs/a/draft-keep.md", false))
+	assert.True(t, m.Match("sub/local.md", false))
+	assert.True(t, m.Match("sub/x/local.md", false))
+	assert.False(t, m.Match("local.md", false))
+	assert.False(t, m.Match("README.md", false))
+}
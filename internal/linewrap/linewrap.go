@@ -2,6 +2,7 @@ package linewrap
 
 import (
 	"io"
+	"strings"
 )
 
 // Wrapper accepts string tokens and outputs them
@@ -169,3 +170,18 @@ func (w *Wrapper) Newline() {
 	w.count = 0
 	w.newLine = true
 }
+
+// BlankLine writes an empty line. The prefix is written with any trailing
+// whitespace removed, so that indented blocks do not leave trailing spaces,
+// except for a block quote marker which is written as '> ' (like Newline.)
+func (w *Wrapper) BlankLine() {
+	w.TerminateLine()
+	prefix := strings.TrimRight(w.prefix, " \t")
+	if strings.HasSuffix(prefix, ">") {
+		prefix += " "
+	}
+	w.out.Write([]byte(prefix))
+	w.out.Write([]byte("\n"))
+	w.count = 0
+	w.newLine = true
+}
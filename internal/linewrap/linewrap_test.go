@@ -64,3 +64,15 @@ func TestWrapperMarkdown(t *testing.T) {
 	expected := "# Hello, world\n\n Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do\neiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim\nveniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo\nconsequat.\n\n> Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor\n> incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis\n> nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.\n> \n> ```\n> hello   world\n> ```\n\ngoodbye world\n"
 	assert.Equal(t, expected, buf.String())
 }
+
+func TestWrapperBlankLine(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New(buf, 80).NewEmbedded("   ", "   ")
+
+	w.WriteTokens([]string{"one", "two"})
+	w.BlankLine()
+	w.WriteTokens([]string{"three"})
+	w.TerminateLine()
+
+	assert.Equal(t, "   one two\n\n   three\n", buf.String())
+}
@@ -0,0 +1,195 @@
+// Package links checks the destinations of links and images in markdown
+// documents: relative paths against the filesystem, and anchors against the
+// headings of the document they point to.
+package links
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/renderer"
+)
+
+// Broken is a link which could not be resolved
+type Broken struct {
+	Path   string // document containing the link
+	Line   int    // line of the block containing the link, starting at 1
+	Dest   string
+	Reason string
+}
+
+func (b Broken) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", b.Path, b.Line, b.Dest, b.Reason)
+}
+
+// Checker checks links, caching the anchors of each document it reads
+type Checker struct {
+	// Root is the directory which absolute link paths (i.e. "/docs/a.md")
+	// are resolved against
+	Root string
+	// IsMarkdown reports whether a file is a markdown document, whose
+	// headings are link anchors
+	IsMarkdown func(path string) bool
+	// Client is used to check external (http and https) links. If it is
+	// nil, external links are not checked.
+	Client *http.Client
+
+	anchors map[string]map[string]bool
+}
+
+// NewChecker returns a Checker which resolves absolute link paths against
+// root, and does not check external links
+func NewChecker(root string) *Checker {
+	return &Checker{
+		Root: root,
+		IsMarkdown: func(path string) bool {
+			return strings.HasSuffix(path, ".md")
+		},
+		anchors: map[string]map[string]bool{},
+	}
+}
+
+// parse parses a markdown document, returning the tree and the line of
+// each top level node
+func parse(path string) (*blackfriday.Node, map[*blackfriday.Node]int, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return renderer.New(80).Parse(dat)
+}
+
+// documentAnchors returns the set of heading anchors of a markdown document
+func (c *Checker) documentAnchors(path string, root *blackfriday.Node) map[string]bool {
+	if a, ok := c.anchors[path]; ok {
+		return a
+	}
+
+	a := map[string]bool{}
+	if root != nil && root.FirstChild != nil {
+		for _, anchor := range renderer.HeadingAnchors(root.FirstChild) {
+			a[anchor] = true
+		}
+	}
+	c.anchors[path] = a
+	return a
+}
+
+// CheckFile checks every link and image destination in a markdown document,
+// returning those which are broken
+func (c *Checker) CheckFile(path string) ([]Broken, error) {
+	root, lines, err := parse(path)
+	if err != nil {
+		return nil, err
+	}
+	self, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	c.documentAnchors(self, root)
+
+	broken := []Broken{}
+	var walkErr error
+	root.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || (n.Type != blackfriday.Link && n.Type != blackfriday.Image) {
+			return blackfriday.GoToNext
+		}
+
+		dest := string(n.LinkData.Destination)
+		reason, err := c.check(self, dest)
+		if err != nil {
+			walkErr = err
+			return blackfriday.Terminate
+		}
+		if reason != "" {
+			top := n
+			for top.Parent != nil && top.Parent != root {
+				top = top.Parent
+			}
+			broken = append(broken, Broken{path, lines[top], dest, reason})
+		}
+		return blackfriday.GoToNext
+	})
+	return broken, walkErr
+}
+
+// check resolves a link destination found in the document at path (which is
+// absolute), returning why it is broken or "" if it is not
+func (c *Checker) check(path, dest string) (string, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "invalid link", nil
+	}
+
+	if u.Scheme != "" || u.Host != "" {
+		if c.Client == nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return "", nil
+		}
+		return c.checkExternal(dest), nil
+	}
+
+	target := path
+	if u.Path != "" {
+		if strings.HasPrefix(u.Path, "/") {
+			target = filepath.Join(c.Root, filepath.FromSlash(u.Path))
+		} else {
+			target = filepath.Join(filepath.Dir(path), filepath.FromSlash(u.Path))
+		}
+		target, err = filepath.Abs(target)
+		if err != nil {
+			return "", err
+		}
+
+		fi, err := os.Stat(target)
+		if os.IsNotExist(err) {
+			return "no such file or directory", nil
+		} else if err != nil {
+			return "", err
+		}
+		if fi.IsDir() {
+			return "", nil
+		}
+	}
+
+	if u.Fragment == "" || !c.IsMarkdown(target) {
+		return "", nil
+	}
+
+	anchors, ok := c.anchors[target]
+	if !ok {
+		root, _, err := parse(target)
+		if err != nil {
+			return "", err
+		}
+		anchors = c.documentAnchors(target, root)
+	}
+	if !anchors[u.Fragment] {
+		return "no heading with anchor #" + u.Fragment, nil
+	}
+	return "", nil
+}
+
+// checkExternal requests an external link, returning why it is broken or ""
+// if it is not
+func (c *Checker) checkExternal(dest string) string {
+	resp, err := c.Client.Head(dest)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = c.Client.Get(dest)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	return ""
+}
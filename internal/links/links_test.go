@@ -0,0 +1,75 @@
+package links
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "links")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"README.md": "# Project\n\nSee [usage](docs/usage.md#install), [missing](docs/gone.md)\nand [the top](#project).\n\n" +
+			"## Details\n\n[bad anchor](docs/usage.md#uninstall) ![logo](img/logo.png)\n" +
+			"[docs](docs/) [absolute](/docs/usage.md#usage) [self](#nowhere)\n\n" +
+			"<http://example.com/>\n",
+		"docs/usage.md":  "# Usage\n\n## Install\n\nBack to [the readme](../README.md#details).\n",
+		"img/logo.png":   "png",
+		"docs/other.txt": "text",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+
+	c := NewChecker(dir)
+	readme := filepath.Join(dir, "README.md")
+	broken, err := c.CheckFile(readme)
+	require.NoError(t, err)
+	assert.Equal(t, []Broken{
+		{readme, 3, "docs/gone.md", "no such file or directory"},
+		{readme, 8, "docs/usage.md#uninstall", "no heading with anchor #uninstall"},
+		{readme, 8, "#nowhere", "no heading with anchor #nowhere"},
+	}, broken)
+
+	broken, err = c.CheckFile(filepath.Join(dir, "docs/usage.md"))
+	require.NoError(t, err)
+	assert.Empty(t, broken)
+}
+
+func TestCheckExternal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "links")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.md")
+	src := "[ok](" + server.URL + "/ok) [gone](" + server.URL + "/gone)\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+
+	c := NewChecker(dir)
+	broken, err := c.CheckFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, broken, "external links checked without a client")
+
+	c.Client = server.Client()
+	broken, err = c.CheckFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Broken{{path, 1, server.URL + "/gone", "404 Not Found"}}, broken)
+}
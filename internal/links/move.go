@@ -0,0 +1,132 @@
+package links
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/renderer"
+)
+
+// Move rewrites link destinations for a file which is moved from Old to New.
+// Relative links to the file from other documents are pointed at its new
+// path, and relative links in the file (if it is a markdown document) are
+// rewritten to resolve from its new directory.
+type Move struct {
+	// Root is the directory which absolute link paths (i.e. "/docs/a.md")
+	// are resolved against
+	Root     string
+	Old, New string
+}
+
+// NewMove returns a Move of the file from to the path to, with absolute
+// link paths resolved against root
+func NewMove(root, from, to string) (*Move, error) {
+	var err error
+	m := &Move{}
+	m.Root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	m.Old, err = filepath.Abs(from)
+	if err != nil {
+		return nil, err
+	}
+	m.New, err = filepath.Abs(to)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Rewrite rewrites the link and image destinations of the markdown document
+// dat, which is at path before the move, and renders it with opts. Returns
+// the output, and whether any destination was changed (even if rendering
+// failed.)
+func (m *Move) Rewrite(path string, dat []byte, opts renderer.Options) ([]byte, bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := false
+	rewrite := func(root *blackfriday.Node, lines map[*blackfriday.Node]int) error {
+		root.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+			if entering && (n.Type == blackfriday.Link || n.Type == blackfriday.Image) {
+				dest, ok := m.destination(path, string(n.LinkData.Destination))
+				if ok {
+					n.LinkData.Destination = []byte(dest)
+					changed = true
+				}
+			}
+			return blackfriday.GoToNext
+		})
+		return nil
+	}
+
+	out, err := renderer.NewOptions(opts).RenderRewrite(dat, rewrite)
+	if err != nil {
+		return nil, changed, err
+	}
+	return out, changed, nil
+}
+
+// destination returns the rewritten destination of a link in the document at
+// path (before the move), and whether it changed
+func (m *Move) destination(path, dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return dest, false
+	}
+
+	dir := filepath.Dir(path)
+	absolute := strings.HasPrefix(u.Path, "/")
+	var target string
+	if absolute {
+		target = filepath.Join(m.Root, filepath.FromSlash(u.Path))
+	} else {
+		target = filepath.Join(dir, filepath.FromSlash(u.Path))
+	}
+
+	moved := target == m.Old
+	if moved {
+		target = m.New
+	}
+	if path == m.Old {
+		dir = filepath.Dir(m.New)
+	} else if !moved {
+		return dest, false
+	}
+	if absolute && !moved {
+		return dest, false
+	}
+
+	var p string
+	if absolute {
+		rel, err := filepath.Rel(m.Root, target)
+		if err != nil {
+			return dest, false
+		}
+		p = "/" + filepath.ToSlash(rel)
+	} else {
+		rel, err := filepath.Rel(dir, target)
+		if err != nil {
+			return dest, false
+		}
+		p = filepath.ToSlash(rel)
+	}
+	if strings.HasSuffix(u.Path, "/") && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	if p == u.Path {
+		return dest, false
+	}
+
+	// only the path is re-escaped, the rest of the destination is kept
+	rest := ""
+	if i := strings.IndexAny(dest, "?#"); i >= 0 {
+		rest = dest[i:]
+	}
+	return (&url.URL{Path: p}).EscapedPath() + rest, true
+}
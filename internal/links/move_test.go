@@ -0,0 +1,40 @@
+package links
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bobertlo/vmd/internal/renderer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveRewrite(t *testing.T) {
+	root := filepath.FromSlash("/repo")
+	m, err := NewMove(root, "/repo/docs/a/setup.md", "/repo/docs/guides/setup.md")
+	require.NoError(t, err)
+	opts := renderer.Options{Cols: 80}
+
+	// inbound links
+	src := "See [setup](docs/a/setup.md#install),   [absolute](/docs/a/setup.md?x=1)\nand [other](docs/a/other.md).\n"
+	out, changed, err := m.Rewrite("/repo/README.md", []byte(src), opts)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "See [setup](docs/guides/setup.md#install), [absolute](/docs/guides/setup.md?x=1)\nand [other](docs/a/other.md).\n", string(out))
+
+	out, changed, err = m.Rewrite("/repo/docs/a/other.md", []byte("[setup](setup.md) [self](#top)\n"), opts)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "[setup](../guides/setup.md) [self](#top)\n", string(out))
+
+	// outbound links
+	src = "[other](other.md) ![img](../../img/a%20b.png) [self](setup.md#x) [abs](/README.md) [web](http://example.com/)\n"
+	out, changed, err = m.Rewrite("/repo/docs/a/setup.md", []byte(src), opts)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "[other](../a/other.md) ![img](../../img/a%20b.png) [self](setup.md#x)\n[abs](/README.md) [web](http://example.com/)\n", string(out))
+
+	_, changed, err = m.Rewrite("/repo/docs/b.md", []byte("[other](a/other.md)\n"), opts)
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,384 @@
+// Package lsp implements a Language Server Protocol server over a stream
+// (usually stdio), which formats markdown documents and reports formatting
+// errors and normalizations as diagnostics.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/bobertlo/vmd/pkg/mdformatter"
+)
+
+// JSON-RPC error codes
+const (
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+	codeInternalError  = -32603
+)
+
+// diagnostic severities
+const (
+	severityError       = 1
+	severityInformation = 3
+)
+
+// textDocumentSyncFull is the TextDocumentSyncKind where clients send the
+// full content of a document on every change
+const textDocumentSyncFull = 1
+
+// message is a JSON-RPC request, notification or response
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+// position is a zero based line and UTF-16 character offset in a document
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// textRange is a span of a document, from Start up to (not including) End
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+// textEdit replaces a range of a document with NewText
+type textEdit struct {
+	Range   textRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+// diagnostic is a problem reported in a document
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type documentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type rangeParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Range        textRange              `json:"range"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// Server is a language server for markdown documents. Requests are handled
+// in order, one at a time.
+type Server struct {
+	opts     mdformatter.Options
+	in       *textproto.Reader
+	out      io.Writer
+	docs     map[string]string
+	shutdown bool
+}
+
+// NewServer returns a Server which formats documents with opts, reading
+// messages from in and writing messages to out. The includes of documents
+// with file URIs are expanded relative to their directory.
+func NewServer(opts mdformatter.Options, in io.Reader, out io.Writer) *Server {
+	return &Server{
+		opts: opts,
+		in:   textproto.NewReader(bufio.NewReader(in)),
+		out:  out,
+		docs: map[string]string{},
+	}
+}
+
+// Run handles messages until the client sends an exit notification (returns
+// nil) or the input ends or is invalid (returns an error)
+func (s *Server) Run() error {
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			// notifications have no response, but failing to send
+			// diagnostics means the client is gone
+			if _, ok := err.(*responseError); err != nil && !ok {
+				return err
+			}
+			continue
+		}
+
+		resp := &message{JSONRPC: "2.0", ID: msg.ID}
+		if err != nil {
+			rerr, ok := err.(*responseError)
+			if !ok {
+				rerr = &responseError{codeInternalError, err.Error()}
+			}
+			resp.Error = rerr
+		} else {
+			raw, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			resp.Result = (*json.RawMessage)(&raw)
+		}
+		err = s.write(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read reads a single message, framed by a Content-Length header
+func (s *Server) read() (*message, error) {
+	header, err := s.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %s", err)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(s.in.R, body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &message{}
+	err = json.Unmarshal(body, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// write writes a single message, framed by a Content-Length header
+func (s *Server) write(msg *message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// notify sends a notification to the client
+func (s *Server) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+// handle handles a request or notification, returning the result of a
+// request
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":                textDocumentSyncFull,
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "vmdfmt"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		err := unmarshalParams(msg, &p)
+		if err != nil {
+			return nil, err
+		}
+		s.docs[p.TextDocument.URI] = p.TextDocument.Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p didChangeParams
+		err := unmarshalParams(msg, &p)
+		if err != nil || len(p.ContentChanges) == 0 {
+			return nil, err
+		}
+		// with full document sync, the last change is the whole document
+		s.docs[p.TextDocument.URI] = p.ContentChanges[len(p.ContentChanges)-1].Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p documentParams
+		err := unmarshalParams(msg, &p)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics",
+			publishDiagnosticsParams{p.TextDocument.URI, []diagnostic{}})
+
+	case "textDocument/formatting":
+		var p documentParams
+		err := unmarshalParams(msg, &p)
+		if err != nil {
+			return nil, err
+		}
+		return s.format(p.TextDocument.URI, nil)
+	case "textDocument/rangeFormatting":
+		var p rangeParams
+		err := unmarshalParams(msg, &p)
+		if err != nil {
+			return nil, err
+		}
+		return s.format(p.TextDocument.URI, &p.Range)
+	}
+
+	if msg.ID == nil {
+		// unknown notifications are ignored
+		return nil, nil
+	}
+	return nil, &responseError{codeMethodNotFound, "method not found: " + msg.Method}
+}
+
+// unmarshalParams decodes the parameters of msg into v
+func unmarshalParams(msg *message, v interface{}) error {
+	err := json.Unmarshal(msg.Params, v)
+	if err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// formatter returns an MDFormatter for the document at uri, which expands
+// includes relative to the document's directory if uri is a file URI
+func (s *Server) formatter(uri string) *mdformatter.MDFormatter {
+	opts := s.opts
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" && u.Path != "" {
+		opts.IncludeDir = filepath.Dir(filepath.FromSlash(u.Path))
+	}
+	return mdformatter.NewOptions(opts)
+}
+
+// format returns the edits which format an open document, or the top level
+// blocks of it intersecting r if r is not nil
+func (s *Server) format(uri string, r *textRange) ([]textEdit, error) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{codeInvalidParams, "document is not open: " + uri}
+	}
+
+	md := s.formatter(uri)
+	var out []byte
+	var err error
+	if r == nil {
+		out, err = md.RenderBytes([]byte(text))
+	} else {
+		last := r.End.Line
+		if r.End.Character == 0 && last > r.Start.Line {
+			// a selection of whole lines ends at the start of the next
+			last--
+		}
+		out, err = md.RenderRange([]byte(text), r.Start.Line+1, last+1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	edits := []textEdit{}
+	if string(out) != text {
+		edits = append(edits, textEdit{
+			Range:   textRange{Start: position{0, 0}, End: endPosition(text)},
+			NewText: string(out),
+		})
+	}
+	return edits, nil
+}
+
+// endPosition returns the position of the end of text
+func endPosition(text string) position {
+	line := strings.Count(text, "\n")
+	last := text[strings.LastIndex(text, "\n")+1:]
+	return position{line, len(utf16.Encode([]rune(last)))}
+}
+
+// publishDiagnostics sends the diagnostics of an open document: an error if
+// it cannot be formatted, and otherwise each normalization which formatting
+// would apply
+func (s *Server) publishDiagnostics(uri string) error {
+	text := []byte(s.docs[uri])
+	diags := []diagnostic{}
+
+	md := s.formatter(uri)
+	_, err := md.RenderBytes(text)
+	if err != nil {
+		diags = append(diags, diagnostic{
+			Range:    textRange{End: position{1, 0}},
+			Severity: severityError,
+			Source:   "vmdfmt",
+			Message:  err.Error(),
+		})
+	} else {
+		for _, n := range md.Explain(text) {
+			diags = append(diags, diagnostic{
+				Range:    textRange{Start: position{n.Line - 1, 0}, End: position{n.Line, 0}},
+				Severity: severityInformation,
+				Source:   "vmdfmt",
+				Message:  n.Rule + ": " + n.Message,
+			})
+		}
+	}
+
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{uri, diags})
+}
@@ -0,0 +1,209 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/bobertlo/vmd/pkg/mdformatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client is an in-process JSON-RPC client connected to a Server
+type client struct {
+	t      *testing.T
+	in     *textproto.Reader
+	out    io.Writer
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T, opts mdformatter.Options) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:    t,
+		in:   textproto.NewReader(bufio.NewReader(clientIn)),
+		out:  clientOut,
+		done: make(chan error, 1),
+	}
+	s := NewServer(opts, serverIn, serverOut)
+	go func() {
+		c.done <- s.Run()
+		serverOut.Close()
+	}()
+	return c
+}
+
+func (c *client) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	require.NoError(c.t, err)
+	_, err = fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	require.NoError(c.t, err)
+}
+
+func (c *client) receive() *message {
+	header, err := c.in.ReadMIMEHeader()
+	require.NoError(c.t, err)
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	require.NoError(c.t, err)
+	body := make([]byte, length)
+	_, err = io.ReadFull(c.in.R, body)
+	require.NoError(c.t, err)
+
+	msg := &message{}
+	require.NoError(c.t, json.Unmarshal(body, msg))
+	return msg
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+// call sends a request, and decodes the result of its response into result
+func (c *client) call(method string, params interface{}, result interface{}) *responseError {
+	c.nextID++
+	c.send(map[string]interface{}{"id": c.nextID, "method": method, "params": params})
+
+	msg := c.receive()
+	require.NotNil(c.t, msg.ID)
+	assert.Equal(c.t, strconv.Itoa(c.nextID), string(*msg.ID))
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if msg.Result != nil {
+		// a null result is decoded as a nil msg.Result
+		require.NoError(c.t, json.Unmarshal(*msg.Result, result))
+	}
+	return nil
+}
+
+// diagnostics receives a publishDiagnostics notification
+func (c *client) diagnostics() publishDiagnosticsParams {
+	msg := c.receive()
+	require.Equal(c.t, "textDocument/publishDiagnostics", msg.Method)
+	var p publishDiagnosticsParams
+	require.NoError(c.t, json.Unmarshal(msg.Params, &p))
+	return p
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t, mdformatter.Options{Cols: 80})
+	uri := "file:///doc.md"
+	doc := map[string]interface{}{"uri": uri}
+
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	require.Nil(t, c.call("initialize", map[string]interface{}{}, &init))
+	assert.Equal(t, true, init.Capabilities["documentFormattingProvider"])
+	assert.Equal(t, true, init.Capabilities["documentRangeFormattingProvider"])
+	c.notify("initialized", map[string]interface{}{})
+
+	text := "Title\n=====\n\nsome   text\n\n* a\n* b\n"
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "markdown", "version": 1, "text": text},
+	})
+	diags := c.diagnostics()
+	assert.Equal(t, uri, diags.URI)
+	require.Len(t, diags.Diagnostics, 4)
+	assert.Equal(t, 0, diags.Diagnostics[0].Range.Start.Line)
+	assert.Equal(t, "heading style: setext heading rewritten as ATX", diags.Diagnostics[0].Message)
+	assert.Equal(t, 3, diags.Diagnostics[1].Range.Start.Line)
+	assert.Equal(t, severityInformation, diags.Diagnostics[1].Severity)
+
+	var edits []textEdit
+	require.Nil(t, c.call("textDocument/formatting", map[string]interface{}{"textDocument": doc}, &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, "# Title\n\nsome text\n\n- a\n- b\n", edits[0].NewText)
+	assert.Equal(t, position{7, 0}, edits[0].Range.End)
+
+	rng := map[string]interface{}{
+		"start": map[string]int{"line": 3, "character": 0},
+		"end":   map[string]int{"line": 4, "character": 0},
+	}
+	require.Nil(t, c.call("textDocument/rangeFormatting", map[string]interface{}{"textDocument": doc, "range": rng}, &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, "Title\n=====\n\nsome text\n\n* a\n* b\n", edits[0].NewText)
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "# Title\n"}},
+	})
+	assert.Len(t, c.diagnostics().Diagnostics, 0)
+	require.Nil(t, c.call("textDocument/formatting", map[string]interface{}{"textDocument": doc}, &edits))
+	assert.Len(t, edits, 0)
+
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": doc})
+	assert.Len(t, c.diagnostics().Diagnostics, 0)
+
+	err := c.call("textDocument/formatting", map[string]interface{}{"textDocument": doc}, &edits)
+	require.NotNil(t, err)
+	assert.Equal(t, codeInvalidParams, err.Code)
+
+	err = c.call("textDocument/hover", map[string]interface{}{}, nil)
+	require.NotNil(t, err)
+	assert.Equal(t, codeMethodNotFound, err.Code)
+
+	var result interface{}
+	require.Nil(t, c.call("shutdown", nil, &result))
+	assert.Nil(t, result)
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
+
+func TestServerErrors(t *testing.T) {
+	c := newClient(t, mdformatter.Options{Cols: 80, CheckAnchors: true})
+	uri := "file:///doc.md"
+
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "text": "# Title\n\n[link](#missing)\n"},
+	})
+	diags := c.diagnostics().Diagnostics
+	require.Len(t, diags, 1)
+	assert.Equal(t, severityError, diags[0].Severity)
+	assert.Contains(t, diags[0].Message, "#missing")
+
+	var edits []textEdit
+	err := c.call("textDocument/formatting", map[string]interface{}{"textDocument": map[string]string{"uri": uri}}, &edits)
+	require.NotNil(t, err)
+	assert.Equal(t, codeInternalError, err.Code)
+
+	c.notify("exit", nil)
+	assert.Error(t, <-c.done)
+}
+
+func TestServerIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "note.md"), []byte("* a note\n"), 0644))
+
+	c := newClient(t, mdformatter.Options{Cols: 80})
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "doc.md"))
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "text": "# Title\n\n<!-- include: note.md -->\n"},
+	})
+	diags := c.diagnostics().Diagnostics
+	require.Len(t, diags, 1)
+	assert.Equal(t, severityInformation, diags[0].Severity)
+	assert.Equal(t, "include: included region from note.md updated", diags[0].Message)
+
+	var edits []textEdit
+	require.Nil(t, c.call("textDocument/formatting", map[string]interface{}{"textDocument": map[string]string{"uri": uri}}, &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, "# Title\n\n<!-- include: note.md -->\n\n- a note\n\n<!-- include-end -->\n", edits[0].NewText)
+
+	c.notify("exit", nil)
+	assert.Error(t, <-c.done)
+}
@@ -0,0 +1,141 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+// Slug converts heading text into a GitHub compatible anchor: lower case,
+// with punctuation removed and spaces replaced by '-'
+func Slug(text string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsNumber(c) || c == '-' || c == '_':
+			b.WriteRune(c)
+		case c == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// Heading anchor styles, for Options.AnchorStyle
+const (
+	AnchorGitHub = "github"
+	AnchorGitLab = "gitlab"
+)
+
+// GitLabSlug converts heading text into a GitLab compatible anchor: as Slug,
+// with runs of '-' collapsed into one
+func GitLabSlug(text string) string {
+	slug := Slug(text)
+	for strings.Contains(slug, "--") {
+		slug = strings.Replace(slug, "--", "-", -1)
+	}
+	return slug
+}
+
+// anchorSlug returns the slug function of an anchor style
+func anchorSlug(style string) func(string) string {
+	if style == AnchorGitLab {
+		return GitLabSlug
+	}
+	return Slug
+}
+
+// HeadingText returns the plain text of a heading node, with any inline
+// formatting removed and whitespace flattened
+func HeadingText(n *blackfriday.Node) string {
+	var b strings.Builder
+	n.Walk(func(c *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (c.Type == blackfriday.Text || c.Type == blackfriday.Code) {
+			b.Write(c.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return string(trimFlattenSpaces([]byte(strings.Replace(b.String(), "\n", " ", -1))))
+}
+
+// HeadingAnchors returns the anchor of every heading in first and its
+// siblings. Headings with an explicit {#id} use it, the rest are given a
+// slug of their text, with duplicate slugs numbered in document order
+// (i.e. "usage", "usage-1", "usage-2".)
+func HeadingAnchors(first *blackfriday.Node) map[*blackfriday.Node]string {
+	return headingAnchors(first, Slug)
+}
+
+// headingAnchors returns the anchor of every heading in first and its
+// siblings as HeadingAnchors does, generating slugs with slug
+func headingAnchors(first *blackfriday.Node, slug func(string) string) map[*blackfriday.Node]string {
+	anchors := map[*blackfriday.Node]string{}
+	used := map[string]bool{}
+	headings := []*blackfriday.Node{}
+
+	walkSiblings(first, func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Heading {
+			return
+		}
+		if n.HeadingData.HeadingID != "" {
+			anchors[n] = n.HeadingData.HeadingID
+			used[n.HeadingData.HeadingID] = true
+		}
+		headings = append(headings, n)
+	})
+
+	for _, n := range headings {
+		if _, ok := anchors[n]; ok {
+			continue
+		}
+		base := slug(HeadingText(n))
+		anchor := base
+		for i := 1; used[anchor]; i++ {
+			anchor = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[anchor] = true
+		anchors[n] = anchor
+	}
+
+	return anchors
+}
+
+// walkSiblings calls fn for every node in the trees rooted at first and each
+// of its siblings, in document order
+func walkSiblings(first *blackfriday.Node, fn func(n *blackfriday.Node)) {
+	for c := first; c != nil; c = c.Next {
+		c.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+			if entering {
+				fn(n)
+			}
+			return blackfriday.GoToNext
+		})
+	}
+}
+
+// checkAnchors returns an error listing every in-document link (i.e.
+// "#anchor") in first and its siblings which does not match a heading anchor
+func checkAnchors(first *blackfriday.Node, anchors map[*blackfriday.Node]string) error {
+	valid := map[string]bool{}
+	for _, a := range anchors {
+		valid[a] = true
+	}
+
+	broken := []string{}
+	walkSiblings(first, func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Link {
+			return
+		}
+		dst := string(n.LinkData.Destination)
+		if strings.HasPrefix(dst, "#") && !valid[dst[1:]] {
+			broken = append(broken, dst)
+		}
+	})
+
+	if len(broken) > 0 {
+		return fmt.Errorf("broken in-document links: %s", strings.Join(broken, ", "))
+	}
+	return nil
+}
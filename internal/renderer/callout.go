@@ -0,0 +1,53 @@
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/linewrap"
+)
+
+// DefaultCalloutTypes are the GitHub callout types, which are accepted if
+// Options.CalloutTypes is not set
+var DefaultCalloutTypes = []string{"NOTE", "TIP", "IMPORTANT", "WARNING", "CAUTION"}
+
+var reCallout = regexp.MustCompile(`^\[!([A-Za-z]+)\]( |$)`)
+
+// callout checks if a Paragraph (the first child of a block quote) begins
+// with a callout marker such as '[!NOTE]'. If it does, the marker is emitted
+// in upper case on its own line, followed by the rest of the paragraph, and
+// (true, nil) is returned. An error is returned if the callout type is not
+// one of the configured types.
+func (r *Renderer) callout(w *linewrap.Wrapper, n *blackfriday.Node) (bool, error) {
+	line, err := compileInline(n.FirstChild)
+	if err != nil {
+		return false, err
+	}
+	m := reCallout.FindStringSubmatch(line)
+	if m == nil {
+		return false, nil
+	}
+
+	kind := strings.ToUpper(m[1])
+	types := r.opts.CalloutTypes
+	if types == nil {
+		types = DefaultCalloutTypes
+	}
+	valid := false
+	for _, t := range types {
+		if strings.ToUpper(t) == kind {
+			valid = true
+		}
+	}
+	if !valid {
+		return false, fmt.Errorf("unknown callout type [!%s]", m[1])
+	}
+
+	w.Write([]byte("[!" + kind + "]"))
+	w.Newline()
+	w.WriteTokens(strings.Split(line[len(m[0]):], " "))
+	w.TerminateLine()
+	return true, nil
+}
@@ -0,0 +1,163 @@
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+// Part is a document to be combined with others by Compose
+type Part struct {
+	// Title, if not empty, is emitted as a heading before the document, which
+	// the document's headings are nested under
+	Title string
+	// Level is the level of the Title heading, or of the shallowest heading
+	// of the document if there is no Title (default: 1)
+	Level  int
+	Source []byte
+	// IncludeDir, if not empty, is the directory which the document's
+	// relative include directive paths are resolved from, in place of
+	// Options.IncludeDir
+	IncludeDir string
+}
+
+// composed is a Part after parsing, with the anchors its headings had in the
+// original document
+type composed struct {
+	first, last *blackfriday.Node // top level nodes of the part
+	anchors     map[*blackfriday.Node]string
+}
+
+// Compose concatenates documents into one and renders it. The headings of
+// each document are shifted to nest under its Title (if any) at its Level,
+// front matter is dropped, and in-document links are rewritten to follow
+// headings whose anchors change to stay unique in the combined document.
+// Returns ([]byte,nil) or (nil,err)
+func (r *Renderer) Compose(parts []Part) ([]byte, error) {
+	root := blackfriday.NewNode(blackfriday.Document)
+	ignored := []string{}
+	starts := map[*blackfriday.Node]int{}
+	includeDirs := map[*blackfriday.Node]string{}
+	slug := anchorSlug(r.opts.AnchorStyle)
+
+	docs := []composed{}
+	for _, p := range parts {
+		_, body := ParseFrontMatter(p.Source)
+		n, err := r.parse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		// ignored regions are numbered from zero in each document
+		for c := n.FirstChild; c != nil; c = c.Next {
+			if c.Type != blackfriday.HTMLBlock {
+				continue
+			}
+			literal := strings.TrimSpace(string(c.Literal))
+			if m := reIgnored.FindStringSubmatch(literal); m != nil {
+				i, _ := strconv.Atoi(m[1])
+				c.Literal = []byte(fmt.Sprintf("<!-- vmdfmt-off %d -->", i+len(ignored)))
+			} else if p.IncludeDir != "" && reInclude.MatchString(literal) {
+				includeDirs[c] = p.IncludeDir
+			}
+		}
+		ignored = append(ignored, r.ignored...)
+		for list, start := range r.starts {
+			starts[list] = start
+		}
+
+		doc := composed{anchors: headingAnchors(n.FirstChild, slug)}
+		level := p.Level
+		if level == 0 {
+			level = 1
+		}
+		if p.Title != "" {
+			h := blackfriday.NewNode(blackfriday.Heading)
+			h.HeadingData.Level = level
+			t := blackfriday.NewNode(blackfriday.Text)
+			t.Literal = []byte(p.Title)
+			h.AppendChild(t)
+			root.AppendChild(h)
+			level++
+		}
+		shiftHeadings(n, level)
+
+		for c := n.FirstChild; c != nil; {
+			next := c.Next
+			c.Unlink()
+			root.AppendChild(c)
+			if doc.first == nil {
+				doc.first = c
+			}
+			doc.last = c
+			c = next
+		}
+		docs = append(docs, doc)
+	}
+
+	uniqueHeadingIDs(root)
+	anchors := headingAnchors(root.FirstChild, slug)
+	for _, doc := range docs {
+		if doc.first == nil {
+			continue
+		}
+		renamed := map[string]string{}
+		for h, a := range doc.anchors {
+			renamed[a] = anchors[h]
+		}
+		for c := doc.first; c != doc.last.Next; c = c.Next {
+			walkType(c, blackfriday.Link, func(n *blackfriday.Node) {
+				dst := string(n.LinkData.Destination)
+				if !strings.HasPrefix(dst, "#") {
+					return
+				}
+				if a, ok := renamed[dst[1:]]; ok {
+					n.LinkData.Destination = []byte("#" + a)
+				}
+			})
+		}
+	}
+
+	r.ignored = ignored
+	r.starts = starts
+	r.includeDirs = includeDirs
+	if root.FirstChild == nil {
+		return []byte{}, nil
+	}
+	return r.Render(root)
+}
+
+// shiftHeadings shifts the level of every heading in the tree under root, so
+// the shallowest is at level. Levels are limited to 6.
+func shiftHeadings(root *blackfriday.Node, level int) {
+	top := 0
+	walkType(root, blackfriday.Heading, func(n *blackfriday.Node) {
+		if top == 0 || n.HeadingData.Level < top {
+			top = n.HeadingData.Level
+		}
+	})
+	walkType(root, blackfriday.Heading, func(n *blackfriday.Node) {
+		n.HeadingData.Level += level - top
+		if n.HeadingData.Level > 6 {
+			n.HeadingData.Level = 6
+		}
+	})
+}
+
+// uniqueHeadingIDs numbers explicit heading IDs which repeat an earlier one
+// (i.e. "install", "install-1")
+func uniqueHeadingIDs(root *blackfriday.Node) {
+	used := map[string]bool{}
+	walkType(root, blackfriday.Heading, func(n *blackfriday.Node) {
+		id := n.HeadingData.HeadingID
+		if id == "" {
+			return
+		}
+		for i := 1; used[n.HeadingData.HeadingID]; i++ {
+			n.HeadingData.HeadingID = fmt.Sprintf("%s-%d", id, i)
+		}
+		used[n.HeadingData.HeadingID] = true
+	})
+}
@@ -0,0 +1,147 @@
+package renderer
+
+import "sort"
+
+// hunk is a run of lines which differ between two documents: the lines
+// [a0, a1) of the first are replaced by the lines [b0, b1) of the second
+type hunk struct {
+	a0, a1, b0, b1 int
+}
+
+// maxDiffCells bounds the size of the table used to diff a run of lines.
+// Longer runs are first split on the lines which occur once on both sides.
+const maxDiffCells = 1 << 22
+
+// diffLines returns the hunks which turn the lines a into the lines b, in
+// order
+func diffLines(a, b []string) []hunk {
+	hunks := []hunk{}
+	diffRange(a, b, hunk{0, len(a), 0, len(b)}, &hunks)
+	return hunks
+}
+
+// diffRange appends the hunks which turn a[h.a0:h.a1] into b[h.b0:h.b1]
+func diffRange(a, b []string, h hunk, hunks *[]hunk) {
+	for h.a0 < h.a1 && h.b0 < h.b1 && a[h.a0] == b[h.b0] {
+		h.a0++
+		h.b0++
+	}
+	for h.a0 < h.a1 && h.b0 < h.b1 && a[h.a1-1] == b[h.b1-1] {
+		h.a1--
+		h.b1--
+	}
+
+	switch {
+	case h.a0 == h.a1 && h.b0 == h.b1:
+		return
+	case h.a0 == h.a1 || h.b0 == h.b1:
+		addHunk(hunks, h)
+	case (h.a1-h.a0)*(h.b1-h.b0) <= maxDiffCells:
+		diffTable(a, b, h, hunks)
+	default:
+		anchors := uniqueAnchors(a, b, h)
+		if len(anchors) == 0 {
+			addHunk(hunks, h)
+			return
+		}
+		for _, m := range anchors {
+			diffRange(a, b, hunk{h.a0, m[0], h.b0, m[1]}, hunks)
+			h.a0, h.b0 = m[0]+1, m[1]+1
+		}
+		diffRange(a, b, h, hunks)
+	}
+}
+
+// diffTable appends the hunks of a longest common subsequence of
+// a[h.a0:h.a1] and b[h.b0:h.b1]
+func diffTable(a, b []string, h hunk, hunks *[]hunk) {
+	n, m := h.a1-h.a0, h.b1-h.b0
+	lcs := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) int32 { return lcs[i*(m+1)+j] }
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[h.a0+i] == b[h.b0+j]:
+				lcs[i*(m+1)+j] = at(i+1, j+1) + 1
+			case at(i+1, j) >= at(i, j+1):
+				lcs[i*(m+1)+j] = at(i+1, j)
+			default:
+				lcs[i*(m+1)+j] = at(i, j+1)
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[h.a0+i] == b[h.b0+j]:
+			i++
+			j++
+		case j == m || (i < n && at(i+1, j) > at(i, j+1)):
+			addHunk(hunks, hunk{h.a0 + i, h.a0 + i + 1, h.b0 + j, h.b0 + j})
+			i++
+		default:
+			addHunk(hunks, hunk{h.a0 + i, h.a0 + i, h.b0 + j, h.b0 + j + 1})
+			j++
+		}
+	}
+}
+
+// uniqueAnchors returns the longest increasing run of pairs of indexes of the
+// lines which occur exactly once in both a[h.a0:h.a1] and b[h.b0:h.b1]
+func uniqueAnchors(a, b []string, h hunk) [][2]int {
+	inA, inB := map[string]int{}, map[string]int{}
+	index := map[string]int{}
+	for i := h.a0; i < h.a1; i++ {
+		inA[a[i]]++
+		index[a[i]] = i
+	}
+	for j := h.b0; j < h.b1; j++ {
+		inB[b[j]]++
+	}
+
+	pairs := [][2]int{}
+	for j := h.b0; j < h.b1; j++ {
+		if inA[b[j]] == 1 && inB[b[j]] == 1 {
+			pairs = append(pairs, [2]int{index[b[j]], j})
+		}
+	}
+	sort.Slice(pairs, func(x, y int) bool { return pairs[x][0] < pairs[y][0] })
+
+	// patience sorting of the pairs on their indexes in b
+	tails := []int{}
+	prev := make([]int, len(pairs))
+	for p := range pairs {
+		k := sort.Search(len(tails), func(t int) bool { return pairs[tails[t]][1] > pairs[p][1] })
+		prev[p] = -1
+		if k > 0 {
+			prev[p] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, p)
+		} else {
+			tails[k] = p
+		}
+	}
+
+	anchors := make([][2]int, len(tails))
+	p := -1
+	if len(tails) > 0 {
+		p = tails[len(tails)-1]
+	}
+	for k := len(anchors) - 1; k >= 0; k-- {
+		anchors[k] = pairs[p]
+		p = prev[p]
+	}
+	return anchors
+}
+
+// addHunk appends h to hunks, merging it with the last hunk if they touch
+func addHunk(hunks *[]hunk, h hunk) {
+	if n := len(*hunks); n > 0 && (*hunks)[n-1].a1 == h.a0 && (*hunks)[n-1].b1 == h.b0 {
+		(*hunks)[n-1].a1 = h.a1
+		(*hunks)[n-1].b1 = h.b1
+		return
+	}
+	*hunks = append(*hunks, h)
+}
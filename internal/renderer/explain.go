@@ -0,0 +1,486 @@
+package renderer
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Normalization rules reported by Explain, in the order they are grouped
+const (
+	RuleHeading  = "heading style"
+	RuleBullet   = "bullet"
+	RuleFence    = "fence"
+	RuleEmphasis = "emphasis delimiter"
+	RuleSpacing  = "spacing"
+	RuleInclude  = "include"
+	RuleOther    = "other"
+)
+
+// Rules lists every normalization rule, in reporting order
+var Rules = []string{RuleHeading, RuleBullet, RuleFence, RuleEmphasis, RuleSpacing, RuleInclude, RuleOther}
+
+// Normalization describes a single change the renderer makes when
+// converting a source document into its canonical form
+type Normalization struct {
+	Line    int // line number in the source document, starting at 1
+	Rule    string
+	Message string
+}
+
+var (
+	reFence        = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*(\\S*)")
+	reSetext       = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	reATXClosed    = regexp.MustCompile(`^ {0,3}#{1,6}\s.*\s#+\s*$`)
+	reBullet       = regexp.MustCompile(`^\s*([*+-])\s+\S`)
+	reOrdered      = regexp.MustCompile(`^\s*\d+([.)])\s+\S`)
+	reThematic     = regexp.MustCompile(`^ {0,3}(-\s*-\s*-[-\s]*|\*\s*\*\s*\*[*\s]*|_\s*_\s*_[_\s]*)$`)
+	reCodeSpan     = regexp.MustCompile("`+[^`]*`+")
+	reLinkDest     = regexp.MustCompile(`\]\([^)]*\)|<[^>\s]*>`)
+	reStrongUnder  = regexp.MustCompile(`(^|[^\w\\])__[^\s_]`)
+	reEmphUnder    = regexp.MustCompile(`(^|[^\w\\_])_[^\s_]`)
+	reInnerSpaces  = regexp.MustCompile(`\S(  +|\t)\S`)
+	reIndentedCode = regexp.MustCompile(`^(    |\t)`)
+
+	// rendered lines confirming a normalization
+	reOutHeading = regexp.MustCompile(`^[>\s]*#{1,6} `)
+	reOutBullet  = regexp.MustCompile(`^[>\s]*- `)
+	reOutFence   = regexp.MustCompile("^[>\\s]*```+$")
+	reOutStrong  = regexp.MustCompile(`\*\*`)
+	reOutEmph    = regexp.MustCompile(`\*`)
+	reOutItem    = regexp.MustCompile(`^[>\s]*([*+-]|\d+[.)])\s`)
+	reOutNumber  = regexp.MustCompile(`^[>\s]*(\d+)[.)]\s`)
+)
+
+// candidate is a normalization found by scanning the source document. It is
+// only reported if the rendered document changes its lines, and if want is
+// set, only if one of the changed lines matches it.
+type candidate struct {
+	Normalization
+	last int // last source line of the normalized construct
+	want *regexp.Regexp
+}
+
+// explainer holds the state of a line based scan of a source document
+type explainer struct {
+	opts   Options
+	out    []candidate
+	line   int
+	blanks int    // number of consecutive blank lines preceding this one
+	inList bool   // the current block is (or continues) a list
+	prev   string // the previous non-blank line
+}
+
+func (e *explainer) add(rule, msg string, want *regexp.Regexp) {
+	n := Normalization{Line: e.line, Rule: rule, Message: msg}
+	e.out = append(e.out, candidate{n, e.line, want})
+}
+
+// extend sets the last source line of the candidates found since the first
+// one to the current line
+func (e *explainer) extend(first int) {
+	for i := first; i < len(e.out); i++ {
+		e.out[i].last = e.line
+	}
+}
+
+// Explain lists the normalizations which the renderer applies to a markdown
+// document, such as setext headings being rewritten as ATX headings or tilde
+// fences as backtick fences. The document is rendered, and each run of lines
+// changed by rendering is explained by the constructs found on those lines of
+// the source, or else by the change itself (i.e. blank lines added between
+// blocks). Nothing is reported for a document which does not render.
+func (r *Renderer) Explain(dat []byte) []Normalization {
+	out, err := NewOptions(r.opts).RenderBytes(dat)
+	if err != nil {
+		return nil
+	}
+	src, dst := sourceLines(dat), sourceLines(out)
+	return confirm(r.scan(dat), joinHunks(diffLines(src, dst), src), src, dst)
+}
+
+// joinHunks joins the hunks separated by blank lines only, which the diff
+// may match on either side of a changed block
+func joinHunks(hunks []hunk, src []string) []hunk {
+	joined := []hunk{}
+	for _, h := range hunks {
+		n := len(joined)
+		if n > 0 && allGaps(src[joined[n-1].a1:h.a0]) {
+			joined[n-1].a1, joined[n-1].b1 = h.a1, h.b1
+			continue
+		}
+		joined = append(joined, h)
+	}
+	return joined
+}
+
+// sourceLines splits a document into its lines, without line endings
+func sourceLines(dat []byte) []string {
+	lines := strings.Split(string(dat), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// confirm reports the candidates which lie on lines changed by one of the
+// hunks, and are matched by its rendered lines. Blank lines added between
+// blocks and renumbered list items are reported for each hunk, and any other
+// change, such as rewrapped text, for a hunk which is otherwise unexplained.
+func confirm(cands []candidate, hunks []hunk, src, dst []string) []Normalization {
+	out := []Normalization{}
+	reported := make([]bool, len(cands))
+	for _, h := range hunks {
+		first, last := h.a0+1, h.a1
+		if h.a0 == h.a1 {
+			first, last = h.a0, h.a0+1
+		}
+		changed := dst[h.b0:h.b1]
+
+		explained := false
+		for i, c := range cands {
+			if c.Line > last || c.last < first || (c.want != nil && !matchAny(c.want, changed)) {
+				continue
+			}
+			explained = true
+			if !reported[i] {
+				reported[i] = true
+				out = append(out, c.Normalization)
+			}
+		}
+
+		extra := append(addedBlanks(h, src, dst), renumbered(h, src, dst)...)
+		if len(extra) == 0 && !explained {
+			extra = append(extra, reformatted(h, src, dst))
+		}
+		out = append(out, extra...)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Line < out[j].Line })
+	return out
+}
+
+// matchAny reports whether re matches one of lines
+func matchAny(re *regexp.Regexp, lines []string) bool {
+	for _, line := range lines {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGap reports whether line is blank, or an empty block quote line
+func isGap(line string) bool {
+	return strings.Trim(line, " \t\r>") == ""
+}
+
+// allGaps reports whether every one of lines is blank
+func allGaps(lines []string) bool {
+	for _, line := range lines {
+		if !isGap(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// countWords returns the number of words of line, not counting the markup
+// (i.e. bullets, fences and heading underlines) made of punctuation only
+func countWords(line string) int {
+	n := 0
+	for _, f := range strings.Fields(line) {
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// totalWords returns the number of words of lines
+func totalWords(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		n += countWords(line)
+	}
+	return n
+}
+
+// gaps returns the number of words preceding each run of blank lines
+func gaps(lines []string) map[int]bool {
+	found := map[int]bool{}
+	words := 0
+	for i, line := range lines {
+		if !isGap(line) {
+			words += countWords(line)
+		} else if i == 0 || !isGap(lines[i-1]) {
+			found[words] = true
+		}
+	}
+	return found
+}
+
+// addedBlanks reports the blank lines which the hunk h adds between blocks.
+// The blank lines of the source and rendered lines are matched by the number
+// of words preceding them, so that rewrapped text does not move them, and
+// nothing is reported for a hunk which changes the number of words.
+func addedBlanks(h hunk, src, dst []string) []Normalization {
+	out := []Normalization{}
+	if totalWords(src[h.a0:h.a1]) != totalWords(dst[h.b0:h.b1]) {
+		return out
+	}
+	before := gaps(src[h.a0:h.a1])
+	words := 0
+	for j := h.b0; j < h.b1; j++ {
+		if !isGap(dst[j]) {
+			words += countWords(dst[j])
+			continue
+		}
+		if (j > h.b0 && isGap(dst[j-1])) || before[words] {
+			continue
+		}
+
+		line := h.a0
+		for n := 0; line < h.a1-1 && n+countWords(src[line]) <= words; line++ {
+			n += countWords(src[line])
+		}
+		msg := "blank line added between blocks"
+		if j > 0 && j+1 < len(dst) && reOutItem.MatchString(dst[j+1]) &&
+			(reOutItem.MatchString(dst[j-1]) || isIndented(strings.TrimLeft(dst[j-1], ">"))) {
+			msg = "blank line added between list items"
+		}
+		out = append(out, Normalization{Line: line + 1, Rule: RuleSpacing, Message: msg})
+	}
+	return out
+}
+
+// renumbered reports the first ordered list item whose number the hunk h
+// changes, if it keeps the number of items
+func renumbered(h hunk, src, dst []string) []Normalization {
+	items := []int{}
+	for i := h.a0; i < h.a1; i++ {
+		if reOutNumber.MatchString(src[i]) {
+			items = append(items, i)
+		}
+	}
+	numbers := []string{}
+	for _, line := range dst[h.b0:h.b1] {
+		if m := reOutNumber.FindStringSubmatch(line); m != nil {
+			numbers = append(numbers, m[1])
+		}
+	}
+	if len(items) != len(numbers) {
+		return nil
+	}
+	for k, i := range items {
+		if reOutNumber.FindStringSubmatch(src[i])[1] != numbers[k] {
+			return []Normalization{{Line: i + 1, Rule: RuleBullet, Message: "ordered list renumbered"}}
+		}
+	}
+	return nil
+}
+
+// reformatted describes the change made by the hunk h, which has no more
+// specific explanation
+func reformatted(h hunk, src, dst []string) Normalization {
+	n := Normalization{Line: h.a0 + 1, Rule: RuleOther, Message: "block reformatted"}
+	if h.a0 == len(src) {
+		n.Line = len(src)
+	}
+	from, to := strings.Join(src[h.a0:h.a1], " "), strings.Join(dst[h.b0:h.b1], " ")
+	if strings.Join(strings.Fields(from), " ") == strings.Join(strings.Fields(to), " ") {
+		n.Rule, n.Message = RuleSpacing, "whitespace changed"
+		if h.a1-h.a0 != h.b1-h.b0 {
+			n.Message = "text rewrapped"
+		}
+	}
+	return n
+}
+
+// scan lists the normalizations which the source document appears to need,
+// from a line based scan of its syntax. Content inside code blocks and
+// ignored regions is passed through verbatim, so it is not reported.
+func (r *Renderer) scan(dat []byte) []candidate {
+	e := &explainer{opts: r.opts}
+
+	offset := 0
+	fm, body := ParseFrontMatter(dat)
+	if fm != nil {
+		offset = bytes.Count(dat[:len(dat)-len(body)], []byte{'\n'})
+	}
+
+	lines := sourceLines(body)
+
+	fence := ""
+	fenceStart := 0
+	ignored := false
+	for i := 0; i < len(lines); i++ {
+		e.line = offset + i + 1
+		line := strings.TrimRight(lines[i], "\r")
+
+		if ignored || (fence == "" && strings.TrimRight(line, " \t") == DirectiveOff) {
+			ignored = strings.TrimRight(line, " \t") != DirectiveOn
+			e.endLine(line)
+			continue
+		}
+
+		if fence == "" && reInclude.MatchString(strings.TrimRight(line, " \t")) {
+			m := reInclude.FindStringSubmatch(strings.TrimSpace(line))
+			e.add(RuleInclude, "included region from "+m[1]+" updated", nil)
+			i = includeEnd(lines, i)
+			e.line = offset + i + 1
+			e.extend(len(e.out) - 1)
+			e.endLine(lines[i])
+			continue
+		}
+
+		if fence != "" {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				e.extend(fenceStart)
+				e.endLine(line)
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if i == 0 {
+				e.add(RuleSpacing, "leading blank line removed", nil)
+			} else if e.blanks == 1 {
+				e.add(RuleSpacing, "consecutive blank lines collapsed", nil)
+			}
+			e.blanks++
+			continue
+		}
+
+		if e.blanks > 0 && !isIndented(line) && !reBullet.MatchString(line) &&
+			!reOrdered.MatchString(line) {
+			e.inList = false
+		}
+
+		if m := reFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			fenceStart = len(e.out)
+			if fence[0] == '~' {
+				e.add(RuleFence, "tilde fence rewritten with backticks", reOutFence)
+			}
+			if m[2] != "" {
+				e.add(RuleFence, "fence info string '"+m[2]+"' removed", reOutFence)
+			}
+			e.endLine(line)
+			continue
+		}
+
+		if reIndentedCode.MatchString(line) && !e.inList && (e.blanks > 0 || e.prev == "") {
+			e.add(RuleFence, "indented code block rewritten as fenced", reOutFence)
+			i = skipIndented(lines, i)
+			e.line = offset + i + 1
+			e.extend(len(e.out) - 1)
+			e.endLine(lines[i])
+			continue
+		}
+
+		e.block(line)
+		e.endLine(line)
+	}
+
+	if len(lines) > 0 && e.blanks > 0 {
+		e.line = offset + len(lines)
+		e.add(RuleSpacing, "trailing blank lines removed", nil)
+	}
+
+	return e.out
+}
+
+// skipIndented returns the index of the last line of the indented code block
+// starting at lines[i]. Blank lines inside of the block are included.
+func skipIndented(lines []string, i int) int {
+	last := i
+	for j := i + 1; j < len(lines); j++ {
+		if reIndentedCode.MatchString(lines[j]) {
+			last = j
+		} else if strings.TrimSpace(lines[j]) != "" {
+			break
+		}
+	}
+	return last
+}
+
+// block checks a line which starts or continues a block for non-canonical
+// syntax
+func (e *explainer) block(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	prev := strings.TrimSpace(e.prev)
+	if reSetext.MatchString(line) && prev != "" && e.blanks == 0 && !e.inList &&
+		!strings.HasPrefix(prev, "|") && !strings.HasPrefix(prev, "#") {
+		e.line--
+		e.add(RuleHeading, "setext heading rewritten as ATX", reOutHeading)
+		e.out[len(e.out)-1].last++
+		return
+	}
+
+	if reThematic.MatchString(line) {
+		return
+	}
+
+	if strings.HasPrefix(trimmed, "#") {
+		if reATXClosed.MatchString(line) {
+			e.add(RuleHeading, "closing '#' characters removed from heading", reOutHeading)
+		}
+		if line != trimmed {
+			e.add(RuleHeading, "heading indentation removed", reOutHeading)
+		}
+	}
+
+	// as in scanLists, a list item can only start a block or continue a list
+	item := e.inList || e.blanks > 0 || e.prev == "" ||
+		reATXHeading.MatchString(e.prev) || reFence.MatchString(e.prev) ||
+		reSetext.MatchString(e.prev)
+	if m := reBullet.FindStringSubmatch(line); m != nil && item {
+		e.inList = true
+		if m[1] != "-" {
+			e.add(RuleBullet, "'"+m[1]+"' bullet rewritten as '-'", reOutBullet)
+		}
+	} else if m := reOrdered.FindStringSubmatch(line); m != nil && item {
+		e.inList = true
+		delim := "."
+		if e.opts.ListDelimiter != 0 {
+			delim = string(e.opts.ListDelimiter)
+		}
+		if m[1] != delim {
+			want := regexp.MustCompile(`^[>\s]*\d+` + regexp.QuoteMeta(delim) + `\s`)
+			e.add(RuleBullet, "'"+m[1]+"' list delimiter rewritten as '"+delim+"'", want)
+		}
+	}
+
+	text := reLinkDest.ReplaceAllString(reCodeSpan.ReplaceAllString(line, "``"), "")
+	if reStrongUnder.MatchString(text) {
+		e.add(RuleEmphasis, "'__' strong emphasis rewritten as '**'", reOutStrong)
+		text = strings.Replace(text, "__", "", -1)
+	}
+	if reEmphUnder.MatchString(text) {
+		e.add(RuleEmphasis, "'_' emphasis rewritten as '*'", reOutEmph)
+	}
+
+	if !strings.HasPrefix(trimmed, "|") && reInnerSpaces.MatchString(trimmed) {
+		e.add(RuleSpacing, "repeated spaces collapsed", nil)
+	}
+	if strings.TrimRight(line, " \t") != line {
+		e.add(RuleSpacing, "trailing whitespace removed", nil)
+	}
+}
+
+// isIndented reports whether line begins with whitespace
+func isIndented(line string) bool {
+	return line != "" && (line[0] == ' ' || line[0] == '\t')
+}
+
+// endLine records line as the previous non-blank line of the scan
+func (e *explainer) endLine(line string) {
+	e.blanks = 0
+	e.prev = line
+}
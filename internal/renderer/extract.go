@@ -0,0 +1,74 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+// section returns the first and last top level nodes of the section of a
+// document under the heading path, where each heading in the path is the
+// first with that text (see HeadingText) in the section of the one before it.
+// A section runs from its heading up to the next heading of the same or a
+// higher level.
+func section(root *blackfriday.Node, path []string) (*blackfriday.Node, *blackfriday.Node, error) {
+	first, last := root.FirstChild, root.LastChild
+	level := 0
+	for i, text := range path {
+		var h *blackfriday.Node
+		for c := first; c != nil && c != last.Next; c = c.Next {
+			if c.Type == blackfriday.Heading && c.HeadingData.Level > level &&
+				HeadingText(c) == strings.TrimSpace(text) {
+				h = c
+				break
+			}
+		}
+		if h == nil {
+			return nil, nil, fmt.Errorf("section %q not found", strings.Join(path[:i+1], "/"))
+		}
+
+		end := h
+		for end != last && !(end.Next.Type == blackfriday.Heading &&
+			end.Next.HeadingData.Level <= h.HeadingData.Level) {
+			end = end.Next
+		}
+		first, last, level = h, end, h.HeadingData.Level
+	}
+	return first, last, nil
+}
+
+// Extract renders the section of a markdown document under a heading path
+// (i.e. {"Changelog", "1.4.0"}), including its heading. If level is not zero,
+// the headings of the section are shifted so that its heading is at level.
+// Returns ([]byte,nil) or (nil,err)
+func (r *Renderer) Extract(dat []byte, path []string, level int) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty section path")
+	}
+	_, body := ParseFrontMatter(dat)
+	n, err := r.parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	first, last, err := section(n, path)
+	if err != nil {
+		return nil, err
+	}
+
+	root := blackfriday.NewNode(blackfriday.Document)
+	for c := first; c != nil; {
+		next := c.Next
+		c.Unlink()
+		root.AppendChild(c)
+		if c == last {
+			break
+		}
+		c = next
+	}
+	if level != 0 {
+		shiftHeadings(root, level)
+	}
+	return r.Render(root)
+}
@@ -16,6 +16,14 @@ var verbatimFiles = []string{
 	"blockquote-issue7.md",
 	"backslash.md",
 	"backslash2.md",
+	"frontmatter-yaml.md",
+	"frontmatter-toml.md",
+	"definition-list.md",
+	"list-spacing.md",
+	"list-numbering.md",
+	"blockquote-blocks.md",
+	"blockquote-callout.md",
+	"ignore-regions.md",
 }
 
 var columnFiles = []string{"lorem.md", "lorem-list.md", "lorem-blocks.md"}
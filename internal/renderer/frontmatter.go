@@ -0,0 +1,249 @@
+package renderer
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// FrontMatterFormat identifies the metadata language of a front matter block
+type FrontMatterFormat int
+
+// Supported front matter formats
+const (
+	YAML FrontMatterFormat = iota // delimited by '---' lines
+	TOML                          // delimited by '+++' lines
+)
+
+// FrontMatter is a metadata block found at the very start of a document.
+// Raw holds the lines between the delimiters, verbatim. Meta holds the top
+// level keys and their (unquoted) values. TOML keys inside of a table are
+// stored as "table.key".
+type FrontMatter struct {
+	Format FrontMatterFormat
+	Raw    []byte
+	Meta   map[string]string
+	open   string
+	close  string
+}
+
+// splitLines splits dat into lines, keeping the line endings
+func splitLines(dat []byte) [][]byte {
+	lines := [][]byte{}
+	for len(dat) > 0 {
+		i := bytes.IndexByte(dat, '\n')
+		if i < 0 {
+			lines = append(lines, dat)
+			break
+		}
+		lines = append(lines, dat[:i+1])
+		dat = dat[i+1:]
+	}
+	return lines
+}
+
+// ParseFrontMatter splits a YAML ('---') or TOML ('+++') front matter block
+// off the start of dat. Returns (fm, rest), where fm is nil and rest is dat
+// if the document does not begin with a complete front matter block. The
+// lines up to the closing delimiter must assign keys (see isMetadata), so
+// that a document starting with a thematic break is not taken as front
+// matter.
+func ParseFrontMatter(dat []byte) (*FrontMatter, []byte) {
+	lines := splitLines(dat)
+	if len(lines) == 0 {
+		return nil, dat
+	}
+
+	open := string(bytes.TrimRight(lines[0], " \t\r\n"))
+	fm := &FrontMatter{open: open}
+	switch open {
+	case "---":
+		fm.Format = YAML
+	case "+++":
+		fm.Format = TOML
+	default:
+		return nil, dat
+	}
+
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		delim := string(bytes.TrimRight(line, " \t\r\n"))
+		if delim == open || (fm.Format == YAML && delim == "...") {
+			fm.close = delim
+			fm.Raw = dat[len(lines[0]):offset]
+			if !fm.isMetadata() {
+				return nil, dat
+			}
+			fm.parseMeta()
+			return fm, dat[offset+len(line):]
+		}
+		offset += len(line)
+	}
+
+	return nil, dat
+}
+
+// keyValue splits a top level "key: value" (YAML) or "key = value" (TOML)
+// line, returning ("", "", false) if line does not assign a key
+func (fm *FrontMatter) keyValue(line string) (string, string, bool) {
+	if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+		return "", "", false
+	}
+	sep := ":"
+	if fm.Format == TOML {
+		sep = "="
+	}
+	i := strings.Index(line, sep)
+	if i <= 0 {
+		return "", "", false
+	}
+	key := unquote(strings.TrimSpace(line[:i]))
+	if fm.Format == YAML && strings.ContainsAny(key, " \t") && line[0] != '"' && line[0] != '\'' {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(line[i+len(sep):]), true
+}
+
+// isMetadata reports whether fm.Raw assigns at least one top level key, and
+// every other line is blank, a comment, a TOML table header or part of the
+// value of a key (i.e. an indented line or a YAML list item)
+func (fm *FrontMatter) isMetadata() bool {
+	keys := 0
+	for _, l := range splitLines(fm.Raw) {
+		line := strings.TrimRight(string(l), " \t\r\n")
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		if _, ok := fm.tableName(line); ok {
+			continue
+		}
+		if _, _, ok := fm.keyValue(line); ok {
+			keys++
+			continue
+		}
+		value := line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(line, "- ") ||
+			(fm.Format == TOML && strings.ContainsAny(line[:1], "]}\"'"))
+		if keys == 0 || !value {
+			return false
+		}
+	}
+	return keys > 0
+}
+
+// tableName returns the name of a TOML table header ("[name]" or
+// "[[name]]"), or ("", false) if line is not a table header
+func (fm *FrontMatter) tableName(line string) (string, bool) {
+	if fm.Format != TOML || !strings.HasPrefix(line, "[") {
+		return "", false
+	}
+	name := strings.Trim(strings.TrimSpace(line), "[]")
+	return strings.TrimSpace(name), true
+}
+
+// unquote strips a matching pair of single or double quotes from s
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseMeta fills in fm.Meta from fm.Raw. Only top level assignments are
+// collected. A YAML key with an empty value takes the following indented
+// (or list item) lines as its value.
+func (fm *FrontMatter) parseMeta() {
+	fm.Meta = map[string]string{}
+	table := ""
+	block := ""
+	for _, l := range splitLines(fm.Raw) {
+		line := strings.TrimRight(string(l), " \t\r\n")
+		if name, ok := fm.tableName(line); ok {
+			table = name + "."
+			continue
+		}
+		if key, value, ok := fm.keyValue(line); ok {
+			block = ""
+			if fm.Format == YAML && (value == "" || value == "|" || value == ">") {
+				block = key
+				fm.Meta[key] = ""
+				continue
+			}
+			fm.Meta[table+key] = unquote(value)
+			continue
+		}
+		if block != "" && strings.TrimSpace(line) != "" {
+			if fm.Meta[block] != "" {
+				fm.Meta[block] += "\n"
+			}
+			fm.Meta[block] += strings.TrimSpace(line)
+		}
+	}
+}
+
+// frontMatterEntry is a top level key, along with the lines which belong to
+// it (continuation lines, nested values, etc.)
+type frontMatterEntry struct {
+	key   string
+	lines [][]byte
+}
+
+// sortedRaw returns fm.Raw with its top level keys sorted. Lines before the
+// first key in a section (comments) stay in place, and TOML tables are kept
+// in order with the keys sorted within each table.
+func (fm *FrontMatter) sortedRaw() []byte {
+	var out bytes.Buffer
+	entries := []frontMatterEntry{}
+
+	flush := func() {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+		for _, e := range entries {
+			for _, l := range e.lines {
+				out.Write(l)
+			}
+		}
+		entries = entries[:0]
+	}
+
+	for _, l := range splitLines(fm.Raw) {
+		line := strings.TrimRight(string(l), " \t\r\n")
+		if _, ok := fm.tableName(line); ok {
+			flush()
+			out.Write(l)
+			continue
+		}
+		if key, _, ok := fm.keyValue(line); ok {
+			entries = append(entries, frontMatterEntry{key: key, lines: [][]byte{l}})
+			continue
+		}
+		if len(entries) == 0 {
+			out.Write(l)
+			continue
+		}
+		last := &entries[len(entries)-1]
+		last.lines = append(last.lines, l)
+	}
+	flush()
+
+	return out.Bytes()
+}
+
+// Bytes returns the front matter block, including delimiters. If sortKeys is
+// set, the top level keys are emitted in sorted order.
+func (fm *FrontMatter) Bytes(sortKeys bool) []byte {
+	var out bytes.Buffer
+	out.WriteString(fm.open)
+	out.WriteByte('\n')
+	if sortKeys {
+		out.Write(fm.sortedRaw())
+	} else {
+		out.Write(fm.Raw)
+	}
+	if out.Len() > 0 && out.Bytes()[out.Len()-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	out.WriteString(fm.close)
+	out.WriteByte('\n')
+	return out.Bytes()
+}
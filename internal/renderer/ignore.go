@@ -0,0 +1,180 @@
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/linewrap"
+)
+
+// Formatter directives, which must be on a line of their own. Source between
+// them is passed through byte-for-byte.
+const (
+	DirectiveOff = "<!-- vmdfmt-off -->"
+	DirectiveOn  = "<!-- vmdfmt-on -->"
+)
+
+var reIgnored = regexp.MustCompile(`^<!-- vmdfmt-off ([0-9]+) -->\s*$`)
+
+// extractIgnored replaces each region of dat from a DirectiveOff line
+// through the following DirectiveOn line (or the end of the document) with a
+// numbered placeholder HTML block, which the parser keeps as a single node.
+// Returns the rewritten source and the raw regions, which Render emits in
+// place of their placeholders.
+func extractIgnored(dat []byte) ([]byte, []string) {
+	regions := []string{}
+	var b strings.Builder
+	var region strings.Builder
+	fence := ""
+	off := false
+
+	for _, l := range splitLines(dat) {
+		line := string(l)
+		directive := strings.TrimRight(line, " \t\r\n")
+
+		if off {
+			region.WriteString(line)
+			if directive == DirectiveOn {
+				regions = append(regions, region.String())
+				off = false
+			}
+			continue
+		}
+
+		if fence != "" {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		} else if m := reFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+		} else if directive == DirectiveOff {
+			fmt.Fprintf(&b, "\n<!-- vmdfmt-off %d -->\n\n", len(regions))
+			region.Reset()
+			region.WriteString(line)
+			off = true
+			continue
+		}
+
+		b.WriteString(line)
+	}
+	if off {
+		regions = append(regions, region.String())
+	}
+
+	if len(regions) == 0 {
+		return dat, nil
+	}
+	return []byte(b.String()), regions
+}
+
+// collapseRegions replaces each region of dat outside of code fences, from a
+// line for which start returns true through the matching stop line (see
+// regionEnd), with the start line alone as an HTML block. A start line
+// without a matching stop line is replaced on its own. Lines are compared
+// with trailing whitespace removed.
+func collapseRegions(dat []byte, start func(line string) bool, stop string) []byte {
+	lines := []string{}
+	for _, line := range splitLines(dat) {
+		lines = append(lines, string(line))
+	}
+	var b strings.Builder
+	fence := ""
+	found := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		directive := strings.TrimRight(line, " \t\r\n")
+
+		if fence != "" || reFence.MatchString(line) {
+			fence = updateFence(fence, line)
+		} else if start(directive) {
+			i = regionEnd(lines, i, start, stop)
+			fmt.Fprintf(&b, "\n%s\n\n", directive)
+			found = true
+			continue
+		}
+
+		b.WriteString(line)
+	}
+
+	if !found {
+		return dat
+	}
+	return []byte(b.String())
+}
+
+// regionEnd returns the index of the stop line matching the start line at
+// lines[i], or i if there is none. Regions may be nested, and lines inside of
+// code fences are skipped.
+func regionEnd(lines []string, i int, start func(line string) bool, stop string) int {
+	depth := 0
+	fence := ""
+	for j := i + 1; j < len(lines); j++ {
+		if fence != "" || reFence.MatchString(lines[j]) {
+			fence = updateFence(fence, lines[j])
+			continue
+		}
+		l := strings.TrimRight(lines[j], " \t\r\n")
+		if start(l) {
+			depth++
+		} else if l == stop && depth > 0 {
+			depth--
+		} else if l == stop {
+			return j
+		}
+	}
+	return i
+}
+
+// updateFence returns the code fence which is open after line, given the one
+// open before it (or "" outside of a fenced code block)
+func updateFence(fence, line string) string {
+	if fence == "" {
+		if m := reFence.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+		return ""
+	}
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+		return ""
+	}
+	return fence
+}
+
+// htmlBlock emits an HTMLBlock node. Only formatter directives are supported:
+// an ignored region placeholder is replaced by the raw source of the region,
+// a table of contents placeholder by the generated table of contents, an
+// include directive by the included file, and a bare directive (when
+// rendering a tree which was not parsed by RenderBytes) is emitted as is.
+func (r *Renderer) htmlBlock(w *linewrap.Wrapper, n *blackfriday.Node) error {
+	literal := strings.TrimSpace(string(n.Literal))
+
+	if m := reIgnored.FindStringSubmatch(literal); m != nil {
+		i, _ := strconv.Atoi(m[1])
+		if i < len(r.ignored) {
+			w.Write([]byte(strings.TrimSuffix(r.ignored[i], "\n")))
+			w.Newline()
+			return nil
+		}
+	}
+
+	if literal == TOCStart {
+		return r.toc(w)
+	}
+	if m := reInclude.FindStringSubmatch(literal); m != nil {
+		return r.include(w, n, literal, m[1])
+	}
+
+	if literal == DirectiveOff || literal == DirectiveOn {
+		w.Write([]byte(literal))
+		w.Newline()
+		return nil
+	}
+
+	return fmt.Errorf("unsupported node type %s ignored", n.Type)
+}
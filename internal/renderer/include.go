@@ -0,0 +1,131 @@
+package renderer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/linewrap"
+)
+
+// IncludeEnd ends the region of an include directive, which starts with a line
+// of the form "<!-- include: path.md -->". The source between them is
+// replaced by the formatted content of the file at path.
+const IncludeEnd = "<!-- include-end -->"
+
+var reInclude = regexp.MustCompile(`^<!-- include: (\S+) -->$`)
+
+// extractIncludes replaces each included region in dat with its include
+// directive alone, which is rendered as the expanded region
+func extractIncludes(dat []byte) []byte {
+	return collapseRegions(dat, reInclude.MatchString, IncludeEnd)
+}
+
+// includeEnd returns the index of the IncludeEnd line matching the include
+// directive at lines[i], or i if there is none
+func includeEnd(lines []string, i int) int {
+	return regionEnd(lines, i, reInclude.MatchString, IncludeEnd)
+}
+
+// includePath resolves the path of an include directive relative to dir,
+// following any symbolic links. Absolute paths, and paths leading out of root
+// (i.e. through ".." or a symbolic link), are an error, so that a document can
+// only include the files of the directory tree it is formatted in.
+func includePath(root, dir, path string) (string, error) {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" ||
+		strings.HasPrefix(path, string(filepath.Separator)) {
+		return "", fmt.Errorf("include: absolute path %s is not allowed", path)
+	}
+	abs, err := filepath.EvalSymlinks(filepath.Join(dir, path))
+	if err != nil {
+		return "", fmt.Errorf("include: %s", err)
+	}
+	if abs, err = filepath.Abs(abs); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("include: %s is outside of %s", path, root)
+	}
+	return abs, nil
+}
+
+// expand returns the formatted content of a file included from dir, with its
+// front matter removed. Its own includes are expanded relative to its
+// directory, and an error is returned if it includes itself, directly or
+// indirectly. Every file included from a document must be in the directory
+// of the document, or one of its subdirectories.
+func (r *Renderer) expand(dir, path string) ([]byte, error) {
+	if dir == "" {
+		dir = "."
+	}
+	root := r.includeRoot
+	if root == "" {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			root, err = filepath.Abs(real)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("include: %s", err)
+		}
+	}
+	abs, err := includePath(root, dir, path)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range r.including {
+		if p == abs {
+			cycle := append(r.including[i:], abs)
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	dat, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("include: %s", err)
+	}
+	_, body := ParseFrontMatter(dat)
+
+	opts := r.opts
+	opts.IncludeDir = filepath.Dir(abs)
+	nested := NewOptions(opts)
+	nested.including = append(append([]string{}, r.including...), abs)
+	nested.includeRoot = root
+	out, err := nested.RenderBytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return out, nil
+}
+
+// include emits an include directive, the formatted content of the file it
+// names and the IncludeEnd marker. Relative paths are resolved from the
+// directory of the Part the directive came from, or else Options.IncludeDir.
+func (r *Renderer) include(w *linewrap.Wrapper, n *blackfriday.Node, directive, path string) error {
+	dir, ok := r.includeDirs[n]
+	if !ok {
+		dir = r.opts.IncludeDir
+	}
+	content, err := r.expand(dir, path)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(directive))
+	w.Newline()
+	if len(content) > 0 {
+		w.BlankLine()
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			w.Write([]byte(line))
+			w.Newline()
+		}
+	}
+	w.BlankLine()
+	w.Write([]byte(IncludeEnd))
+	w.Newline()
+	return nil
+}
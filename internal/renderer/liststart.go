@@ -0,0 +1,593 @@
+package renderer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+var (
+	reListItem   = regexp.MustCompile(`^( *)(\d{1,9}[.)]|[*+-])(\s|$)`)
+	reQuotePrefx = regexp.MustCompile(`^ {0,3}> ?`)
+	reATXHeading = regexp.MustCompile(`^ {0,3}#{1,6}(\s|$)`)
+
+	reUnderline = regexp.MustCompile(`^(=+|-+) *$`)
+	reHTMLTag   = regexp.MustCompile(`^<([a-zA-Z0-9]+)`)
+)
+
+// htmlBlockTags are the tags which start an HTML block
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"canvas": true, "del": true, "div": true, "dl": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "iframe": true, "ins": true, "main": true,
+	"math": true, "nav": true, "noscript": true, "ol": true, "output": true,
+	"p": true, "pre": true, "progress": true, "script": true, "section": true,
+	"style": true, "table": true, "ul": true, "video": true,
+}
+
+// srcLine is a line of the source, with the prefixes of the blocks containing
+// it (block quote markers and list item indentation) removed
+type srcLine struct {
+	n    int    // index of the line in the source, or -1 for a blank line
+	text string // a suffix of the line, without its newline
+}
+
+// listScanner follows the block structure of a document the way the parser
+// does, recording the start number of each ordered list it opens
+type listScanner struct {
+	lines  []string
+	starts []int
+}
+
+// list item flags, as the parser keeps them while parsing a list
+type itemFlags struct {
+	ordered, definition bool
+	term                bool // the item is a definition list term
+	block               bool // items contain blocks (once set, for every item)
+	end                 bool // the last item ended the list
+}
+
+// scanLists scans the source of a document and returns the first number of
+// each ordered list, in document order, since the parser does not record
+// start numbers. The source is scanned with the parser's own rules for where
+// blocks start and end, so a line is only taken as a list item where the
+// parser would take it as one. The parser also only accepts '.' after the
+// number of an ordered list item, so the source is returned with the ')'
+// delimiters of those list items (and no other text) rewritten as '.'.
+func scanLists(dat []byte) ([]int, []byte) {
+	s := &listScanner{lines: strings.Split(string(dat), "\n")}
+	src := []srcLine{}
+	for i, line := range s.lines {
+		src = append(src, srcLine{i, line})
+	}
+	if len(src) > 0 && src[len(src)-1].text == "" {
+		src = src[:len(src)-1]
+	}
+	s.blocks(src)
+	return s.starts, []byte(strings.Join(s.lines, "\n"))
+}
+
+// blocks scans a sequence of blocks
+func (s *listScanner) blocks(lines []srcLine) {
+	for len(lines) > 0 {
+		lines = lines[s.block(lines):]
+	}
+}
+
+// block scans the block starting at lines[0], and returns the number of lines
+// it spans
+func (s *listScanner) block(lines []srcLine) int {
+	text := lines[0].text
+	switch {
+	case isBlankLine(text):
+		return 1
+	case text[0] == '#':
+		return 1
+	}
+	if n := htmlBlockLen(lines); n > 0 {
+		return n
+	}
+	if codePrefix(text) > 0 {
+		n := 1
+		for n < len(lines) && (codePrefix(lines[n].text) > 0 || isBlankLine(lines[n].text)) {
+			n++
+		}
+		return n
+	}
+	if n := fencedBlockLen(lines); n > 0 {
+		return n
+	}
+	if isHRule(text) {
+		return 1
+	}
+	if quotePrefix(text) > 0 {
+		return s.quote(lines)
+	}
+	if n := tableLen(lines); n > 0 {
+		return n
+	}
+	if uliPrefix(text) > 0 {
+		return s.list(lines, itemFlags{})
+	}
+	if oliPrefix(text) > 0 {
+		s.starts = append(s.starts, listStart(text))
+		return s.list(lines, itemFlags{ordered: true})
+	}
+	if dliPrefix(text) > 0 {
+		return s.list(lines, itemFlags{definition: true})
+	}
+	return s.paragraph(lines)
+}
+
+// paragraph scans a paragraph, which may turn out to be a setext heading or
+// the first term of a definition list
+func (s *listScanner) paragraph(lines []srcLine) int {
+	for i := 1; i < len(lines); i++ {
+		text := lines[i].text
+		switch {
+		case isBlankLine(text):
+			// like the parser, the lines scanned as a definition list are
+			// counted from the start of the paragraph
+			if text == "" && i+1 < len(lines) && strings.HasPrefix(lines[i+1].text, ":") {
+				return s.list(lines[i-1:], itemFlags{definition: true})
+			}
+			return i + 1
+		case reUnderline.MatchString(text):
+			return i + 1
+		case text[0] == '#' || isHRule(text) || fencedBlockLen(lines[i:]) > 0:
+			return i
+		case dliPrefix(text) > 0:
+			return s.list(lines[i-1:], itemFlags{definition: true})
+		}
+	}
+	return len(lines)
+}
+
+// quote scans a block quote, whose content is scanned as a sequence of blocks
+// with the quote prefixes removed. A fenced code block opening anywhere in a
+// line is taken whole, without removing the prefixes of its other lines.
+func (s *listScanner) quote(lines []srcLine) int {
+	raw := []srcLine{}
+	i := 0
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if n := quoteFenceLen(lines[i:]); n > 0 {
+			line.text = line.text[quotePrefix(line.text):]
+			raw = append(append(raw, line), lines[i+1:i+n]...)
+			i += n - 1
+			continue
+		}
+		if n := quotePrefix(line.text); n > 0 {
+			line.text = line.text[n:]
+		} else if isBlankLine(line.text) && (i+1 == len(lines) ||
+			(quotePrefix(lines[i+1].text) == 0 && !isBlankLine(lines[i+1].text))) {
+			break
+		}
+		raw = append(raw, line)
+	}
+	s.blocks(raw)
+	return i
+}
+
+// quoteFenceLen returns the number of lines of a fenced code block opening at
+// any position of lines[0], or 0 if there is none
+func quoteFenceLen(lines []srcLine) int {
+	text := lines[0].text
+	for k := range text {
+		if text[k] != '`' && text[k] != '~' {
+			continue
+		}
+		first := srcLine{lines[0].n, text[k:]}
+		if n := fencedBlockLen(append([]srcLine{first}, lines[1:]...)); n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// list scans the items of a list
+func (s *listScanner) list(lines []srcLine, flags itemFlags) int {
+	i := 0
+	for i < len(lines) {
+		n := s.item(lines[i:], &flags)
+		i += n
+		if n == 0 || flags.end {
+			break
+		}
+	}
+	return i
+}
+
+// item scans a list item. Its lines are gathered with their indentation
+// removed, and then scanned as the blocks of the item.
+func (s *listScanner) item(lines []srcLine, flags *itemFlags) int {
+	first := lines[0]
+	itemIndent := 0
+	if first.text[0] == '\t' {
+		itemIndent = 4
+	} else {
+		for itemIndent < 3 && itemIndent < len(first.text) && first.text[itemIndent] == ' ' {
+			itemIndent++
+		}
+	}
+
+	i := uliPrefix(first.text)
+	if i == 0 {
+		i = oliPrefix(first.text)
+		if i > 0 && first.text[i-2] == ')' {
+			s.rewriteDelimiter(first, i-2)
+		}
+	}
+	if i == 0 {
+		i = dliPrefix(first.text)
+		if i > 0 {
+			flags.term = false
+		}
+	}
+	if i == 0 {
+		if !flags.definition {
+			return 0
+		}
+		flags.term = true
+	}
+	for i < len(first.text) && first.text[i] == ' ' {
+		i++
+	}
+
+	raw := []srcLine{{first.n, first.text[i:]}}
+	blank := false
+	sublist := -1
+	fence := ""
+
+	n := 1
+gather:
+	for ; n < len(lines); n++ {
+		text := lines[n].text
+		if isBlankLine(text) {
+			blank = true
+			continue
+		}
+
+		indent, skip := 0, 0
+		if text[0] == '\t' {
+			indent, skip = 4, 1
+		} else {
+			for indent < 4 && indent < len(text) && text[indent] == ' ' {
+				indent++
+			}
+			skip = indent
+		}
+		chunk := srcLine{lines[n].n, text[skip:]}
+
+		// code fences are only recognized on lines of their own
+		if marker := fenceMarker(chunk.text, fence); marker != "" || fence != "" {
+			if marker != "" && fence == "" {
+				fence = marker
+			} else if marker != "" {
+				fence = ""
+			}
+			raw = append(raw, chunk)
+			continue
+		}
+
+		switch {
+		case (uliPrefix(chunk.text) > 0 && !isHRule(chunk.text)) ||
+			oliPrefix(chunk.text) > 0 || dliPrefix(chunk.text) > 0:
+			// an item of this list, or the first item of a different list
+			if indent <= itemIndent {
+				if listTypeChanged(chunk.text, *flags) {
+					flags.end = true
+				} else if blank {
+					flags.block = true
+				}
+				break gather
+			}
+			if blank {
+				flags.block = true
+			}
+			if sublist < 0 {
+				sublist = len(raw)
+			}
+
+		case chunk.text[0] == '#':
+			if blank && indent < 4 {
+				flags.end = true
+				break gather
+			}
+			flags.block = true
+
+		case blank && indent < 4:
+			// unindented text after a blank line ends the list, unless it is
+			// a term followed by a definition
+			if flags.definition && n+1 < len(lines) {
+				after := ""
+				for _, l := range lines[n+2:] {
+					if l.text != "" {
+						after = l.text
+						break
+					}
+				}
+				if !strings.HasPrefix(lines[n+1].text, ":") && !strings.HasPrefix(after, ":") {
+					flags.end = true
+				}
+			} else {
+				flags.end = true
+			}
+			break gather
+
+		case blank:
+			raw = append(raw, srcLine{-1, ""})
+			flags.block = true
+		}
+
+		if blank {
+			blank = false
+			raw = append(raw, srcLine{-1, ""})
+		}
+		raw = append(raw, chunk)
+	}
+
+	switch {
+	case flags.block && !flags.term && sublist >= 0:
+		s.blocks(raw[:sublist])
+		s.blocks(raw[sublist:])
+	case flags.block && !flags.term:
+		s.blocks(raw)
+	case sublist >= 0:
+		// the text before a sublist is a paragraph
+		s.blocks(raw[sublist:])
+	}
+	return n
+}
+
+// rewriteDelimiter rewrites the ')' of an ordered list item at offset i of
+// line as '.'
+func (s *listScanner) rewriteDelimiter(line srcLine, i int) {
+	src := s.lines[line.n]
+	j := len(src) - len(line.text) + i
+	s.lines[line.n] = src[:j] + "." + src[j+1:]
+}
+
+// listTypeChanged returns true if the list item on line is not of the type of
+// the list being scanned
+func listTypeChanged(line string, flags itemFlags) bool {
+	switch {
+	case dliPrefix(line) > 0:
+		return !flags.definition
+	case oliPrefix(line) > 0:
+		return !flags.ordered
+	case uliPrefix(line) > 0:
+		return flags.ordered || flags.definition
+	}
+	return false
+}
+
+// isHRule returns true if line is a thematic break: three or more of the same
+// '*', '-' or '_' character, and spaces
+func isHRule(line string) bool {
+	line = line[indentation(line, 3):]
+	if line == "" || !strings.ContainsRune("*-_", rune(line[0])) {
+		return false
+	}
+	rest := strings.Replace(line, " ", "", -1)
+	return len(rest) >= 3 && strings.Trim(rest, line[:1]) == ""
+}
+
+func isBlankLine(line string) bool {
+	return strings.Trim(line, " \t") == ""
+}
+
+// indentation returns the number of leading spaces of line, up to max
+func indentation(line string, max int) int {
+	i := 0
+	for i < max && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// uliPrefix returns the length of the bullet list item marker at the start of
+// line, or 0
+func uliPrefix(line string) int {
+	i := indentation(line, 3)
+	if i+1 >= len(line) || !strings.ContainsRune("*+-", rune(line[i])) ||
+		(line[i+1] != ' ' && line[i+1] != '\t') {
+		return 0
+	}
+	return i + 2
+}
+
+// listStart returns the number of the ordered list item on line
+func listStart(line string) int {
+	line = line[indentation(line, 3):]
+	n, _ := strconv.Atoi(line[:strings.IndexAny(line, ".)")])
+	return n
+}
+
+// oliPrefix returns the length of the ordered list item marker at the start
+// of line, or 0. The ')' delimiter is accepted, as it is rewritten to '.'.
+func oliPrefix(line string) int {
+	i := indentation(line, 3)
+	start := i
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	if i == start || i+1 >= len(line) || (line[i] != '.' && line[i] != ')') ||
+		(line[i+1] != ' ' && line[i+1] != '\t') {
+		return 0
+	}
+	return i + 2
+}
+
+// dliPrefix returns the length of the definition marker at the start of line,
+// or 0
+func dliPrefix(line string) int {
+	if len(line) < 2 || line[0] != ':' || (line[1] != ' ' && line[1] != '\t') {
+		return 0
+	}
+	return 2
+}
+
+// quotePrefix returns the length of the block quote marker at the start of
+// line, or 0
+func quotePrefix(line string) int {
+	if m := reQuotePrefx.FindString(line); m != "" {
+		return len(m)
+	}
+	return 0
+}
+
+// codePrefix returns the length of the indentation of an indented code block
+// at the start of line, or 0
+func codePrefix(line string) int {
+	if strings.HasPrefix(line, "\t") {
+		return 1
+	}
+	if strings.HasPrefix(line, "    ") {
+		return 4
+	}
+	return 0
+}
+
+// fenceMarker returns the fence of line if it is a code fence alone (closing
+// open, if it is not empty), or ""
+func fenceMarker(line, open string) string {
+	trimmed := line[indentation(line, 3):]
+	if trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	marker := strings.TrimRight(trimmed, trimmed[:1])
+	if marker != "" || len(trimmed) < 3 || (open != "" && trimmed != open) {
+		return ""
+	}
+	return trimmed
+}
+
+// fencedBlockLen returns the number of lines of the fenced code block starting
+// at lines[0], or 0 if there is none. A fence without a closing fence does
+// not start a code block.
+func fencedBlockLen(lines []srcLine) int {
+	m := reFence.FindStringSubmatch(lines[0].text)
+	if m == nil {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		if fenceMarker(lines[i].text, m[1]) != "" {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// tableLen returns the number of lines of the table starting at lines[0], or 0
+// if there is none
+func tableLen(lines []srcLine) int {
+	if len(lines) < 2 || !isTableDelimiter(lines[1].text, tableColumns(lines[0].text)) {
+		return 0
+	}
+	n := 2
+	for n < len(lines) && strings.Contains(lines[n].text, "|") {
+		n++
+	}
+	return n
+}
+
+// tableColumns returns the number of columns of a table header row, or 0 if
+// line has none
+func tableColumns(line string) int {
+	cols := 1
+	for i := range line {
+		if line[i] == '|' && (i == 0 || line[i-1] != '\\') {
+			cols++
+		}
+	}
+	if cols == 1 {
+		return 0
+	}
+	if strings.HasPrefix(line, "|") {
+		cols--
+	}
+	if len(line) > 2 && strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		cols--
+	}
+	return cols
+}
+
+// isTableDelimiter returns true if line is the delimiter row of a table with
+// cols columns, each of at least three dashes (and alignment colons)
+func isTableDelimiter(line string, cols int) bool {
+	cells := strings.Split(strings.TrimSpace(line), "|")
+	if len(cells) > 1 && strings.TrimSpace(cells[0]) == "" {
+		cells = cells[1:]
+	}
+	if len(cells) > 1 && strings.TrimSpace(cells[len(cells)-1]) == "" {
+		cells = cells[:len(cells)-1]
+	}
+	if cols == 0 || len(cells) != cols {
+		return false
+	}
+	for _, cell := range cells {
+		cell = strings.TrimSpace(cell)
+		if len(cell) < 3 || strings.Trim(strings.TrimSuffix(strings.TrimPrefix(cell, ":"), ":"), "-") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// htmlBlockLen returns the number of lines of the HTML block (a comment, or a
+// block level element) starting at lines[0], or 0 if there is none. The block
+// must be followed by a blank line.
+func htmlBlockLen(lines []srcLine) int {
+	text := lines[0].text
+	end := ""
+	if strings.HasPrefix(text, "<!--") {
+		end = "-->"
+	} else if m := reHTMLTag.FindStringSubmatch(text); m != nil && htmlBlockTags[strings.ToLower(m[1])] {
+		end = "</" + m[1] + ">"
+	} else {
+		return 0
+	}
+
+	for i, line := range lines {
+		text := line.text
+		if i == 0 && end == "-->" {
+			text = text[4:]
+		}
+		j := strings.Index(text, end)
+		if j < 0 || !isBlankLine(text[j+len(end):]) {
+			continue
+		}
+		if end == "-->" || i+1 == len(lines) || isBlankLine(lines[i+1].text) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// orderedListStarts matches the start numbers scanned from the source of a
+// document with its ordered List nodes. If the number of lists found differs,
+// the scan cannot be matched with the tree, and every list is numbered from 1.
+func orderedListStarts(starts []int, root *blackfriday.Node) map[*blackfriday.Node]int {
+	lists := []*blackfriday.Node{}
+	root.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && n.Type == blackfriday.List &&
+			n.ListData.ListFlags&blackfriday.ListTypeOrdered > 0 {
+			lists = append(lists, n)
+		}
+		return blackfriday.GoToNext
+	})
+
+	m := map[*blackfriday.Node]int{}
+	if len(starts) != len(lists) {
+		return m
+	}
+	for i, n := range lists {
+		m[n] = starts[i]
+	}
+	return m
+}
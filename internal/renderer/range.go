@@ -0,0 +1,283 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+// blockSpan is a run of source lines holding one or more whole top level
+// blocks of a document body
+type blockSpan struct {
+	start, end int    // byte offsets of the first and past the last line
+	line, last int    // line indexes (from 0) of the first and last line
+	nodes      [2]int // index of the first top level node, and past the last
+}
+
+var reLineMark = regexp.MustCompile(`^<!-- vmdfmt-line ([0-9]+) -->\s*$`)
+
+// parseBody parses a document body as Renderer.parse does, without the
+// Renderer's state
+func parseBody(body []byte) (*blackfriday.Node, error) {
+	body, _ = extractIgnored(body)
+	body = extractTOC(extractIncludes(body))
+	_, body = scanLists(body)
+	return ParseMarkdown(body)
+}
+
+// blockStarts returns the indexes of the lines of a document body which may
+// start a top level block: those following a blank line, a heading or a code
+// fence (outside of code fences and ignored regions), which do not continue
+// the list, block quote, definition list or indented code block before them.
+func blockStarts(lines [][]byte) []int {
+	starts := []int{}
+	fence := ""
+	ignored := false
+	start := true
+	context := "" // the kind of block the last start began
+	listIndent, listOrdered := 0, false
+	for i, l := range lines {
+		line := string(l)
+		expanded := strings.Replace(strings.TrimRight(line, " \t\r\n"), "\t", "    ", -1)
+		trimmed := strings.TrimSpace(expanded)
+
+		switch {
+		case ignored:
+			ignored = trimmed != DirectiveOn
+			continue
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				start = true
+			}
+			continue
+		case trimmed == "":
+			start = true
+			continue
+		}
+
+		if start {
+			indent := len(expanded) - len(strings.TrimLeft(expanded, " "))
+			kind := ""
+			switch {
+			case indent >= 4:
+				kind = "code"
+				if context == "list" || context == "defs" {
+					kind = context
+				}
+			case reListItem.MatchString(expanded):
+				kind = "list"
+				// an item of another type at the indentation of the list
+				// starts a new list
+				m := reListItem.FindStringSubmatch(expanded)
+				ordered := m[2][0] >= '0' && m[2][0] <= '9'
+				if context == "list" && indent <= listIndent && ordered != listOrdered {
+					context = ""
+				}
+				if context != "list" {
+					listIndent, listOrdered = indent, ordered
+				}
+			case reQuotePrefx.MatchString(expanded):
+				kind = "quote"
+			case trimmed[0] == ':':
+				kind = "defs"
+			case isTerm(lines, i):
+				kind = "defs"
+			}
+			if kind == "" || kind != context {
+				starts = append(starts, i)
+			}
+			context = kind
+		}
+
+		start = reATXHeading.MatchString(expanded)
+		if trimmed == DirectiveOff {
+			ignored = true
+		} else if m := reFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			start = false
+		}
+	}
+	return starts
+}
+
+// isTerm reports whether lines[i] is a definition list term: whether the next
+// non-blank line is a definition
+func isTerm(lines [][]byte, i int) bool {
+	for _, l := range lines[i+1:] {
+		if t := bytes.TrimSpace(l); len(t) > 0 {
+			return t[0] == ':'
+		}
+	}
+	return false
+}
+
+// blockSpans splits a document body with total top level nodes into spans of
+// top level blocks, parsing it once: a placeholder HTML block is inserted
+// before each line which may start a top level block, and the nodes between
+// two placeholders belong to the span starting at the first. If the
+// placeholders changed the nodes of the document, the whole body is a single
+// span. Blank lines between spans belong to no span.
+func blockSpans(body []byte, total int) []blockSpan {
+	lines := splitLines(body)
+	offsets := make([]int, len(lines)+1)
+	for i, l := range lines {
+		offsets[i+1] = offsets[i] + len(l)
+	}
+
+	candidates := blockStarts(lines)
+	var marked bytes.Buffer
+	next := 0
+	for i, l := range lines {
+		if next < len(candidates) && candidates[next] == i {
+			fmt.Fprintf(&marked, "<!-- vmdfmt-line %d -->\n\n", next)
+			next++
+		}
+		marked.Write(l)
+	}
+
+	// line indexes at which a span starts, and the number of top level
+	// nodes before them
+	type boundary struct{ line, nodes int }
+	bounds := []boundary{{0, 0}}
+	count := 0
+	n, err := parseBody(marked.Bytes())
+	if err == nil {
+		for c := n.FirstChild; c != nil; c = c.Next {
+			m := reLineMark.FindStringSubmatch(strings.TrimSpace(string(c.Literal)))
+			if c.Type == blackfriday.HTMLBlock && m != nil {
+				i, _ := strconv.Atoi(m[1])
+				bounds = append(bounds, boundary{candidates[i], count})
+				continue
+			}
+			count++
+		}
+	}
+	if count != total {
+		bounds = bounds[:1]
+	}
+	bounds = append(bounds, boundary{len(lines), total})
+
+	spans := []blockSpan{}
+	for i := 0; i+1 < len(bounds); i++ {
+		first, last := bounds[i].line, bounds[i+1].line-1
+		for first <= last && len(bytes.TrimSpace(lines[first])) == 0 {
+			first++
+		}
+		for last >= first && len(bytes.TrimSpace(lines[last])) == 0 {
+			last--
+		}
+		if first > last {
+			continue
+		}
+		spans = append(spans, blockSpan{
+			start: offsets[first],
+			end:   offsets[last+1],
+			line:  first,
+			last:  last,
+			nodes: [2]int{bounds[i].nodes, bounds[i+1].nodes},
+		})
+	}
+	return spans
+}
+
+// Parse parses a markdown document as RenderBytes does, returning the tree
+// and the source line (counting from 1) at which each top level node begins.
+// The front matter block is not part of the tree, and ignored regions are
+// placeholder HTML blocks. Top level nodes which do not start after a blank
+// line, a heading or a code fence share the line of the first of them.
+func (r *Renderer) Parse(dat []byte) (*blackfriday.Node, map[*blackfriday.Node]int, error) {
+	_, body := ParseFrontMatter(dat)
+	offset := bytes.Count(dat[:len(dat)-len(body)], []byte{'\n'})
+
+	n, err := r.parse(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := []*blackfriday.Node{}
+	for c := n.FirstChild; c != nil; c = c.Next {
+		nodes = append(nodes, c)
+	}
+
+	lines := map[*blackfriday.Node]int{}
+	for _, s := range blockSpans(body, len(nodes)) {
+		for i := s.nodes[0]; i < s.nodes[1] && i < len(nodes); i++ {
+			lines[nodes[i]] = offset + s.line + 1
+		}
+	}
+	return n, lines, nil
+}
+
+// RenderRewrite parses a markdown document as Parse does, calls rewrite with
+// the tree and the line of each top level node, and renders the rewritten
+// tree as RenderBytes does. Returns ([]byte,nil) or (nil,err)
+func (r *Renderer) RenderRewrite(dat []byte, rewrite func(*blackfriday.Node, map[*blackfriday.Node]int) error) ([]byte, error) {
+	fm, _ := ParseFrontMatter(dat)
+	n, lines, err := r.Parse(dat)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rewrite(n, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := r.Render(n)
+	if err != nil {
+		return nil, err
+	}
+	return r.withFrontMatter(fm, out), nil
+}
+
+// RenderRange formats only the top level blocks of a markdown document which
+// intersect the lines first through last (counting from 1), for formatting a
+// selection in an editor. Every other line of the document, including the
+// blank lines between blocks, is returned byte-for-byte. The front matter
+// block counts as a single block. Returns ([]byte,nil) or (nil,err)
+func (r *Renderer) RenderRange(dat []byte, first, last int) ([]byte, error) {
+	fm, body := ParseFrontMatter(dat)
+	head := dat[:len(dat)-len(body)]
+	offset := bytes.Count(head, []byte{'\n'})
+
+	n, err := r.parse(body)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.Render(n)
+	if err != nil {
+		return nil, err
+	}
+	rendered := r.out.Bytes()
+
+	var out bytes.Buffer
+	if fm != nil && first <= offset {
+		out.Write(fm.Bytes(r.opts.SortFrontMatter))
+	} else {
+		out.Write(head)
+	}
+
+	pos := 0
+	for _, s := range blockSpans(body, len(r.blocks)-1) {
+		out.Write(body[pos:s.start])
+		pos = s.end
+
+		from, to := s.nodes[0], s.nodes[1]
+		if from == to || to >= len(r.blocks) ||
+			offset+s.last+1 < first || offset+s.line+1 > last {
+			// spans without nodes (i.e. link reference definitions) are
+			// always kept, as the blocks using them may not be formatted
+			out.Write(body[s.start:s.end])
+			continue
+		}
+		out.Write(rendered[r.blocks[from] : r.blocks[to]-1])
+	}
+	out.Write(body[pos:])
+
+	return out.Bytes(), nil
+}
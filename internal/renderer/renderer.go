@@ -15,8 +15,60 @@ import (
 
 // Renderer renders blackfriday markdown trees into []byte output
 type Renderer struct {
-	out  *bytes.Buffer
-	cols int
+	out     *bytes.Buffer
+	opts    Options
+	anchors map[*blackfriday.Node]string
+	root    *blackfriday.Node // first top level node being rendered
+	starts  map[*blackfriday.Node]int
+	ignored []string
+
+	// including lists the absolute paths of the files being included, to
+	// detect include cycles
+	including []string
+	// includeRoot is the directory which the files being included must be
+	// in, or empty when rendering a top level document
+	includeRoot string
+	// includeDirs holds the directory of the include directives of composed
+	// parts with their own IncludeDir
+	includeDirs map[*blackfriday.Node]string
+
+	// blocks holds the offset in out of each top level node rendered by
+	// Render, followed by the length of out
+	blocks []int
+}
+
+// Options configures the output of a Renderer
+type Options struct {
+	Cols            int  // number of columns to wrap lines at
+	SortFrontMatter bool // emit front matter with its top level keys sorted
+	HeadingIDs      bool // pin a generated {#id} on headings without one
+	CheckAnchors    bool // fail on "#anchor" links which match no heading
+
+	// ListDelimiter is emitted after the number of ordered list items, '.'
+	// (the default) or ')'
+	ListDelimiter byte
+	// UniformNumbering numbers every ordered list item with the start number
+	// of its list, so inserting an item does not renumber the rest
+	UniformNumbering bool
+
+	// CalloutTypes lists the accepted block quote callout types (i.e. "NOTE"
+	// for '> [!NOTE]'). If nil, DefaultCalloutTypes is used.
+	CalloutTypes []string
+
+	// Rewrites are applied in order to the tree of each parsed document
+	Rewrites []Rewrite
+
+	// TOCDepth is the deepest heading level listed in a table of contents
+	// (default: DefaultTOCDepth)
+	TOCDepth int
+	// AnchorStyle selects how heading anchors are generated, AnchorGitHub
+	// (the default) or AnchorGitLab
+	AnchorStyle string
+
+	// IncludeDir is the directory which relative include directive paths are
+	// resolved against, normally that of the document (default: the current
+	// directory)
+	IncludeDir string
 }
 
 // flattenSpaces removes all reduntant spaces from a []byte array, leaving
@@ -47,7 +99,8 @@ func LoadMarkdown(path string) (*blackfriday.Node, error) {
 func ParseMarkdown(dat []byte) (*blackfriday.Node, error) {
 	m := blackfriday.New(blackfriday.WithExtensions(
 		blackfriday.Tables | blackfriday.FencedCode |
-			blackfriday.NoIntraEmphasis))
+			blackfriday.NoIntraEmphasis | blackfriday.DefinitionLists |
+			blackfriday.HeadingIDs))
 	n := m.Parse(dat)
 
 	return n, nil
@@ -56,10 +109,15 @@ func ParseMarkdown(dat []byte) (*blackfriday.Node, error) {
 // New creates a new markdown Renderer. cols specifies how many columns to
 // wrap lines at.
 func New(cols int) *Renderer {
+	return NewOptions(Options{Cols: cols})
+}
+
+// NewOptions creates a new markdown Renderer configured by opts.
+func NewOptions(opts Options) *Renderer {
 	buf := new(bytes.Buffer)
 	r := &Renderer{
 		out:  buf,
-		cols: cols,
+		opts: opts,
 	}
 	return r
 }
@@ -67,31 +125,68 @@ func New(cols int) *Renderer {
 // RenderFile renders a markdown file to the out buffer, returning a formatted
 // ([]byte,nil) or (nil,err) if an error occurs
 func (r *Renderer) RenderFile(path string) ([]byte, error) {
-	n, err := LoadMarkdown(path)
+	dat, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return r.Render(n)
+	return r.RenderBytes(dat)
 }
 
 // RenderBytes parses a markdown document in a []byte and renders it,
-// returning a formatted document in a []byte. Returns ([]byte,nil) or
-// (nil,err)
+// returning a formatted document in a []byte. A front matter block at the
+// start of the document is passed through verbatim (or with its keys sorted,
+// if SortFrontMatter is set.) Ordered lists keep the start number from the
+// source, and regions between DirectiveOff and DirectiveOn lines are passed
+// through byte-for-byte. Returns ([]byte,nil) or (nil,err)
 func (r *Renderer) RenderBytes(dat []byte) ([]byte, error) {
-	n, err := ParseMarkdown(dat)
+	fm, body := ParseFrontMatter(dat)
+	n, err := r.parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := r.Render(n)
 	if err != nil {
 		return nil, err
 	}
+	return r.withFrontMatter(fm, out), nil
+}
 
-	return r.Render(n)
+// withFrontMatter prepends the front matter block fm (if not nil) to the
+// rendered body of a document
+func (r *Renderer) withFrontMatter(fm *FrontMatter, out []byte) []byte {
+	if fm == nil {
+		return out
+	}
+
+	head := fm.Bytes(r.opts.SortFrontMatter)
+	if len(out) == 0 {
+		return head
+	}
+	return append(append(head, '\n'), out...)
 }
 
-// writes 'c' n times
-func (r *Renderer) writeNBytes(n int, c byte) {
-	for i := 0; i < n; i++ {
-		r.out.WriteByte(c)
+// parse parses the body of a document (after any front matter) for Render:
+// ignored regions are replaced by placeholders, and the start numbers of
+// ordered lists are recorded, and tables of contents and included regions are
+// emptied. Then the Rewrites are applied.
+func (r *Renderer) parse(body []byte) (*blackfriday.Node, error) {
+	body, r.ignored = extractIgnored(body)
+	r.includeDirs = nil
+	body = extractTOC(extractIncludes(body))
+	starts, body := scanLists(body)
+
+	n, err := ParseMarkdown(body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.starts = orderedListStarts(starts, n)
+	for _, rewrite := range r.opts.Rewrites {
+		rewrite(n)
 	}
+	return n, nil
 }
 
 // Render a blackfriday markdown tree and return the output as a []byte.
@@ -102,47 +197,27 @@ func (r *Renderer) Render(root *blackfriday.Node) ([]byte, error) {
 		root = root.FirstChild
 	}
 
+	r.root = root
+	r.anchors = headingAnchors(root, anchorSlug(r.opts.AnchorStyle))
+	if r.opts.CheckAnchors {
+		err := checkAnchors(root, r.anchors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.out = new(bytes.Buffer)
+	r.blocks = r.blocks[:0]
 	for c := root; c != nil; c = c.Next {
-		switch c.Type {
-		case blackfriday.Heading:
-			err := r.heading(c)
-			if err != nil {
-				return nil, err
-			}
-		case blackfriday.Paragraph:
-			w := linewrap.New(r.out, r.cols)
-			err := r.paragraph(w, c)
-			if err != nil {
-				return nil, err
-			}
-			w.Newline()
-		case blackfriday.CodeBlock:
-			w := linewrap.New(r.out, r.cols)
-			r.codeBlock(w, c)
-			r.out.WriteByte('\n')
-		case blackfriday.BlockQuote:
-			w := linewrap.New(r.out, r.cols)
-			err := r.blockQuote(w, c)
-			if err != nil {
-				return nil, err
-			}
-			r.out.WriteByte('\n')
-		case blackfriday.List:
-			w := linewrap.New(r.out, r.cols)
-			err := r.list(w, c)
-			if err != nil {
-				return nil, err
-			}
-			w.Newline()
-		case blackfriday.Table:
-			err := r.table(c)
-			if err != nil {
-				return nil, err
-			}
-		default:
-			return nil, fmt.Errorf("unsupported node type %s ignored", c.Type)
+		r.blocks = append(r.blocks, r.out.Len())
+		w := linewrap.New(r.out, r.opts.Cols)
+		err := r.block(w, c)
+		if err != nil {
+			return nil, err
 		}
+		r.out.WriteByte('\n')
 	}
+	r.blocks = append(r.blocks, r.out.Len())
 
 	// remove empty newline at end of file
 	out := r.out.Bytes()
@@ -155,33 +230,70 @@ func (r *Renderer) Render(root *blackfriday.Node) ([]byte, error) {
 	return out, nil
 }
 
+// block emits a single block level node to a linewrap writer, ending with a
+// terminated line. Any type of block may be nested inside of block quotes and
+// list items, so they all write through the (prefixed) writer.
+func (r *Renderer) block(w *linewrap.Wrapper, n *blackfriday.Node) error {
+	switch n.Type {
+	case blackfriday.Heading:
+		return r.heading(w, n)
+	case blackfriday.Paragraph:
+		return r.paragraph(w, n)
+	case blackfriday.CodeBlock:
+		r.codeBlock(w, n)
+	case blackfriday.BlockQuote:
+		return r.blockQuote(w, n)
+	case blackfriday.List:
+		return r.list(w, n)
+	case blackfriday.Table:
+		return r.table(w, n)
+	case blackfriday.HorizontalRule:
+		w.Write([]byte("***"))
+		w.Newline()
+	case blackfriday.HTMLBlock:
+		return r.htmlBlock(w, n)
+	default:
+		return fmt.Errorf("unsupported node type %s ignored", n.Type)
+	}
+	return nil
+}
+
 // headingText checks that n and siblings are text nodes (there shouldn't
-// be any siblings) and outputs all the text with whitespace flattened, or
+// be any siblings) and returns all the text with whitespace flattened, or
 // returns an error if an invalid (non Text) node is found
-func (r *Renderer) headingText(n *blackfriday.Node) error {
-	for p := n; p != nil; p = n.Next {
+func headingText(n *blackfriday.Node) (string, error) {
+	var b bytes.Buffer
+	for p := n; p != nil; p = p.Next {
 		if p.Type != blackfriday.Text {
-			return errors.New("Headings may only contain text elements")
+			return "", errors.New("Headings may only contain text elements")
 		}
-		r.out.Write(trimFlattenSpaces(p.Literal))
+		b.Write(trimFlattenSpaces(p.Literal))
 	}
-	return nil
+	return b.String(), nil
 }
 
 // heading outputs a heading node (verified before calling) as an atx-heading
 // (e.i '#' for each heading level) followed by the contents of each of it's
 // text node children (which should be only one) with whitespace flattened
 // or returns an error if an invalid (non Text) node is found. Headings are
-// line based and cannot be wrapped, so the output is a raw line.
-func (r *Renderer) heading(n *blackfriday.Node) error {
-	level := n.HeadingData.Level
-	r.writeNBytes(level, '#')
-	r.out.WriteByte(' ')
-	err := r.headingText(n.FirstChild)
+// line based and cannot be wrapped, so the output is a raw line. A heading ID
+// is emitted after the text as '{#id}'.
+func (r *Renderer) heading(w *linewrap.Wrapper, n *blackfriday.Node) error {
+	text, err := headingText(n.FirstChild)
 	if err != nil {
 		return err
 	}
-	r.out.WriteString("\n\n")
+	line := strings.Repeat("#", n.HeadingData.Level) + " " + text
+
+	id := n.HeadingData.HeadingID
+	if id == "" && r.opts.HeadingIDs {
+		id = r.anchors[n]
+	}
+	if id != "" {
+		line += " {#" + id + "}"
+	}
+	w.Write([]byte(line))
+	w.Newline()
 	return nil
 }
 
@@ -296,6 +408,13 @@ func compileInline(n *blackfriday.Node) (string, error) {
 	return b.String(), nil
 }
 
+// InlineText renders an inline node and all of its siblings (i.e. the
+// children of a paragraph or table cell) as they are formatted, before line
+// wrapping. Returns (string, nil) or ("", err)
+func InlineText(n *blackfriday.Node) (string, error) {
+	return compileInline(n)
+}
+
 // wrapInline renders a node and all following children into a string, then
 // tokenizes it based on whitespace and emits those tokens using a linewrapper,
 // which is supplied to support recursion in lists and other types of blocks
@@ -317,8 +436,10 @@ func (r *Renderer) paragraph(w *linewrap.Wrapper, n *blackfriday.Node) error {
 	return r.wrapInline(w, n.FirstChild)
 }
 
-// blockQuote takes a BlockQuote node, and emits it. Only paragraphs and
-// embedded BlockQuote nodes are admitted
+// blockQuote takes a BlockQuote node, and emits it. Each of its children is
+// rendered through a wrapper which prefixes every line with '> ', and they
+// are separated by a quoted blank line. A callout marker (i.e. '[!NOTE]') at
+// the start of the block quote is kept on its own line.
 func (r *Renderer) blockQuote(w *linewrap.Wrapper, n *blackfriday.Node) error {
 	subw := w.NewEmbedded("> ", "> ")
 	first := true
@@ -329,18 +450,21 @@ func (r *Renderer) blockQuote(w *linewrap.Wrapper, n *blackfriday.Node) error {
 			subw.Newline()
 		}
 
-		if c.Type == blackfriday.Paragraph {
-			r.paragraph(subw, c)
-			subw.TerminateLine()
-		} else if c.Type == blackfriday.BlockQuote {
-			r.blockQuote(subw, c)
-			subw.TerminateLine()
-		} else if c.Type == blackfriday.CodeBlock {
-			r.codeBlock(subw, c)
-			subw.TerminateLine()
-		} else {
-			return errors.New("BlockQuotes may only contain paragraphs or BlockQuotes")
+		if c == n.FirstChild && c.Type == blackfriday.Paragraph {
+			ok, err := r.callout(subw, c)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+		}
+
+		err := r.block(subw, c)
+		if err != nil {
+			return err
 		}
+		subw.TerminateLine()
 	}
 	return nil
 }
@@ -366,29 +490,121 @@ func (r *Renderer) codeBlock(w *linewrap.Wrapper, n *blackfriday.Node) {
 	//w.Newline()
 }
 
-// list emits a list, including any sublists recursively to a linewrap writer
+// list emits a list, including any sublists recursively to a linewrap writer.
+// Tight lists are emitted without blank lines between items, loose lists with
+// a single blank line between each item. Ordered lists are numbered from the
+// start number of the source list.
 func (r *Renderer) list(w *linewrap.Wrapper, n *blackfriday.Node) error {
+	if n.ListData.ListFlags&blackfriday.ListTypeDefinition > 0 {
+		return r.definitionList(w, n)
+	}
+
 	ordered := n.ListData.ListFlags&blackfriday.ListTypeOrdered > 0
 	index := 1
+	if start, ok := r.starts[n]; ok {
+		index = start
+	}
+	delim := r.opts.ListDelimiter
+	if delim == 0 {
+		delim = '.'
+	}
 
 	for c := n.FirstChild; c != nil; c = c.Next {
 		if c.Type != blackfriday.Item {
 			return errors.New("all list children must be 'Item' type")
 		}
-		if c.FirstChild.Type == blackfriday.Paragraph {
-			if ordered {
-				prefix := fmt.Sprintf("%d. ", index)
-				subw := w.NewEmbedded(prefix, "   ")
-				r.paragraph(subw, c.FirstChild)
-			} else {
-				subw := w.NewEmbedded("- ", "   ")
-				r.paragraph(subw, c.FirstChild)
+		if c != n.FirstChild && !n.ListData.Tight {
+			w.BlankLine()
+		}
+		prefix := "- "
+		if ordered {
+			prefix = fmt.Sprintf("%d%c ", index, delim)
+		}
+		err := r.listItem(w, c, prefix)
+		if err != nil {
+			return err
+		}
+		if !r.opts.UniformNumbering {
+			index++
+		}
+	}
+
+	return nil
+}
+
+// listItem emits the blocks of a list Item. The first block follows the item
+// prefix, and a sublist directly after it is indented by three columns. Any
+// other blocks are separated by a blank line and indented by four columns,
+// which the parser requires for content following a blank line in an item.
+func (r *Renderer) listItem(w *linewrap.Wrapper, n *blackfriday.Node, prefix string) error {
+	for c := n.FirstChild; c != nil; c = c.Next {
+		var subw *linewrap.Wrapper
+		if c == n.FirstChild {
+			subw = w.NewEmbedded(prefix, "   ")
+		} else if c.Type == blackfriday.List && c.Prev == n.FirstChild &&
+			c.Prev.Type == blackfriday.Paragraph {
+			subw = w.NewEmbedded("   ", "   ")
+		} else {
+			w.BlankLine()
+			subw = w.NewEmbedded("    ", "    ")
+		}
+
+		err := r.block(subw, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// definitionList emits a definition list. Each term is written on a single
+// line, followed by its definitions, which start with ': ' and continue with
+// two columns of indentation. Term groups are separated by a blank line, and
+// loose lists also have a blank line between a term and its definitions.
+func (r *Renderer) definitionList(w *linewrap.Wrapper, n *blackfriday.Node) error {
+	first := true
+	for c := n.FirstChild; c != nil; c = c.Next {
+		if c.Type != blackfriday.Item || c.FirstChild == nil {
+			return errors.New("all list children must be 'Item' type")
+		}
+
+		if c.ListFlags&blackfriday.ListTypeTerm > 0 {
+			if c.FirstChild.Type != blackfriday.Paragraph {
+				return errors.New("definition terms may only contain text")
 			}
+			term, err := compileInline(c.FirstChild.FirstChild)
+			if err != nil {
+				return err
+			}
+			if !first {
+				w.BlankLine()
+			}
+			first = false
+			w.Write([]byte(term))
+			w.Newline()
+			if !n.ListData.Tight {
+				w.BlankLine()
+			}
+			continue
 		}
-		if c.FirstChild.Next != nil && c.FirstChild.Next.Type == blackfriday.List {
-			r.list(w.NewEmbedded("   ", "   "), c.FirstChild.Next)
+
+		for p := c.FirstChild; p != nil; p = p.Next {
+			if p.Type != blackfriday.Paragraph {
+				return errors.New("definitions may only contain paragraphs")
+			}
+			if p == c.FirstChild {
+				err := r.paragraph(w.NewEmbedded(": ", "  "), p)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			w.BlankLine()
+			err := r.paragraph(w.NewEmbedded("    ", "    "), p)
+			if err != nil {
+				return err
+			}
 		}
-		index++
 	}
 
 	return nil
@@ -416,7 +632,20 @@ func tableWidth(n *blackfriday.Node) (int, error) {
 	return cols, nil
 }
 
-func (r *Renderer) table(n *blackfriday.Node) error {
+// tableRow formats a row of table cells, padding each cell to the width of
+// the widest cell in its column
+func tableRow(cells []string, max []int) []byte {
+	var b bytes.Buffer
+	for i := range cells {
+		fmt.Fprintf(&b, "| %s", cells[i])
+		b.WriteString(strings.Repeat(" ", max[i]-utf8.RuneCountInString(cells[i])+1))
+	}
+	b.WriteByte('|')
+	return b.Bytes()
+}
+
+// table emits a Table node, one line per row, with the columns aligned
+func (r *Renderer) table(w *linewrap.Wrapper, n *blackfriday.Node) error {
 	width, err := tableWidth(n)
 	if err != nil {
 		return err
@@ -486,27 +715,22 @@ func (r *Renderer) table(n *blackfriday.Node) error {
 	}
 
 	// output table head
-	for i := 0; i < width; i++ {
-		fmt.Fprintf(r.out, "| %s", headData[i])
-		r.writeNBytes(max[i]-utf8.RuneCountInString(headData[i])+1, ' ')
-	}
-	fmt.Fprintln(r.out, "|")
+	w.Write(tableRow(headData, max))
+	w.Newline()
 
+	var b bytes.Buffer
 	for i := 0; i < width; i++ {
-		r.out.WriteByte('|')
-		r.writeNBytes(max[i]+2, '-')
+		b.WriteByte('|')
+		b.WriteString(strings.Repeat("-", max[i]+2))
 	}
-	fmt.Fprintln(r.out, "|")
+	b.WriteByte('|')
+	w.Write(b.Bytes())
+	w.Newline()
 
 	for i := range values {
-		for j := 0; j < width; j++ {
-			fmt.Fprintf(r.out, "| %s", values[i][j])
-			r.writeNBytes(max[j]-utf8.RuneCountInString(values[i][j])+1, ' ')
-		}
-		fmt.Fprintln(r.out, "|")
+		w.Write(tableRow(values[i], max))
+		w.Newline()
 	}
 
-	r.out.WriteByte('\n')
-
 	return nil
 }
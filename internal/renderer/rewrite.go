@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+// Rewrite is a structured rewrite of a markdown tree, applied after parsing
+// and before rendering
+type Rewrite func(root *blackfriday.Node)
+
+// ParseRewrite parses a rewrite rule of the form "kind:pattern -> replacement"
+// where kind is one of:
+//
+//	url      link and image destinations starting with pattern have it
+//	         replaced, i.e. "url:http://old.example.com/ -> https://example.com/"
+//	heading  headings of level pattern (1 to 6, or '*' for every level) are
+//	         given the level replacement, or shifted by it if it is signed,
+//	         i.e. "heading:2 -> 3" or "heading:* -> +1"
+//	text     the word pattern is replaced in text outside of code, link
+//	         destinations and HTML, i.e. "text:colour -> color"
+func ParseRewrite(rule string) (Rewrite, error) {
+	parts := strings.SplitN(rule, "->", 2)
+	kind := strings.SplitN(parts[0], ":", 2)
+	if len(parts) != 2 || len(kind) != 2 {
+		return nil, fmt.Errorf("invalid rewrite rule %q, expected 'kind:pattern -> replacement'", rule)
+	}
+	pattern := strings.TrimSpace(kind[1])
+	replacement := strings.TrimSpace(parts[1])
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid rewrite rule %q, empty pattern", rule)
+	}
+
+	switch strings.TrimSpace(kind[0]) {
+	case "url":
+		return urlRewrite(pattern, replacement), nil
+	case "heading":
+		return headingRewrite(pattern, replacement)
+	case "text":
+		return textRewrite(pattern, replacement), nil
+	}
+	return nil, fmt.Errorf("unknown rewrite kind %q in %q (url, heading or text)", kind[0], rule)
+}
+
+// walkType calls fn for each node of type t in the tree under root
+func walkType(root *blackfriday.Node, t blackfriday.NodeType, fn func(n *blackfriday.Node)) {
+	root.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && n.Type == t {
+			fn(n)
+		}
+		return blackfriday.GoToNext
+	})
+}
+
+// urlRewrite replaces the prefix of link and image destinations
+func urlRewrite(prefix, replacement string) Rewrite {
+	rewrite := func(n *blackfriday.Node) {
+		dst := string(n.LinkData.Destination)
+		if strings.HasPrefix(dst, prefix) {
+			n.LinkData.Destination = []byte(replacement + dst[len(prefix):])
+		}
+	}
+	return func(root *blackfriday.Node) {
+		walkType(root, blackfriday.Link, rewrite)
+		walkType(root, blackfriday.Image, rewrite)
+	}
+}
+
+// headingRewrite changes the level of headings
+func headingRewrite(pattern, replacement string) (Rewrite, error) {
+	from := 0
+	if pattern != "*" {
+		var err error
+		from, err = strconv.Atoi(pattern)
+		if err != nil || from < 1 || from > 6 {
+			return nil, fmt.Errorf("invalid heading level %q, expected 1 to 6 or '*'", pattern)
+		}
+	}
+
+	to, err := strconv.Atoi(replacement)
+	relative := strings.HasPrefix(replacement, "+") || strings.HasPrefix(replacement, "-")
+	if err != nil || (!relative && (to < 1 || to > 6)) {
+		return nil, fmt.Errorf("invalid heading level %q, expected 1 to 6, or a signed shift", replacement)
+	}
+
+	return func(root *blackfriday.Node) {
+		walkType(root, blackfriday.Heading, func(n *blackfriday.Node) {
+			level := n.HeadingData.Level
+			if from != 0 && level != from {
+				return
+			}
+			if relative {
+				level += to
+			} else {
+				level = to
+			}
+			if level < 1 {
+				level = 1
+			} else if level > 6 {
+				level = 6
+			}
+			n.HeadingData.Level = level
+		})
+	}, nil
+}
+
+// textRewrite replaces a word in text nodes. Code spans, code blocks and
+// HTML are separate node types, and link destinations are not text, so they
+// are not changed.
+func textRewrite(word, replacement string) Rewrite {
+	expr := regexp.QuoteMeta(word)
+	if isWordByte(word[0]) {
+		expr = `\b` + expr
+	}
+	if isWordByte(word[len(word)-1]) {
+		expr += `\b`
+	}
+	re := regexp.MustCompile(expr)
+
+	return func(root *blackfriday.Node) {
+		walkType(root, blackfriday.Text, func(n *blackfriday.Node) {
+			n.Literal = re.ReplaceAllLiteral(n.Literal, []byte(replacement))
+		})
+	}
+}
+
+// isWordByte reports whether c is matched by \w
+func isWordByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
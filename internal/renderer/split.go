@@ -0,0 +1,164 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+)
+
+// SplitFile is a section of a document written to its own file by Split
+type SplitFile struct {
+	Name    string // file name, a slug of the section heading
+	Content []byte
+}
+
+// splitPart is a document produced by Split, before rendering
+type splitPart struct {
+	root *blackfriday.Node
+	name string
+}
+
+// Split cuts a markdown document (whose file name is name) at its top level
+// headings of level, returning an index document and a file for each section.
+// A section runs from its heading up to the next heading of the same or a
+// higher level, and its headings are shifted so its own is at level 1. Each
+// run of sections is replaced in the index by a list of links to their files,
+// which are named by a slug of their heading, and in-document links are
+// rewritten to point at the file the heading was moved to. Returns the index,
+// the section files in document order, and an error.
+func (r *Renderer) Split(dat []byte, name string, level int) ([]byte, []SplitFile, error) {
+	fm, body := ParseFrontMatter(dat)
+	n, err := r.parse(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	slug := anchorSlug(r.opts.AnchorStyle)
+	anchors := headingAnchors(n.FirstChild, slug)
+
+	index := blackfriday.NewNode(blackfriday.Document)
+	parts := []splitPart{{index, name}}
+	used := map[string]bool{name: true}
+
+	// the links to a run of sections, added to the index when it ends
+	var links strings.Builder
+	flush := func() error {
+		if links.Len() == 0 {
+			return nil
+		}
+		list, err := ParseMarkdown([]byte(links.String()))
+		if err != nil {
+			return err
+		}
+		index.AppendChild(list.FirstChild)
+		links.Reset()
+		return nil
+	}
+
+	for c := n.FirstChild; c != nil; {
+		if c.Type != blackfriday.Heading || c.HeadingData.Level != level {
+			next := c.Next
+			err := flush()
+			if err != nil {
+				return nil, nil, err
+			}
+			c.Unlink()
+			index.AppendChild(c)
+			c = next
+			continue
+		}
+
+		file := splitName(slug(HeadingText(c)), used)
+		fmt.Fprintf(&links, "- [%s](%s)\n", HeadingText(c), file)
+
+		root := blackfriday.NewNode(blackfriday.Document)
+		for done := false; !done; {
+			next := c.Next
+			c.Unlink()
+			root.AppendChild(c)
+			c = next
+			done = c == nil || (c.Type == blackfriday.Heading && c.HeadingData.Level <= level)
+		}
+		shiftHeadings(root, 1)
+		parts = append(parts, splitPart{root, file})
+	}
+	err = flush()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) == 1 {
+		return nil, nil, fmt.Errorf("no level %d headings to split at", level)
+	}
+
+	rewriteSplitLinks(parts, anchors, slug)
+
+	out := [][]byte{}
+	for _, p := range parts {
+		res, err := r.Render(p.root)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", p.name, err)
+		}
+		out = append(out, res)
+	}
+
+	files := []SplitFile{}
+	for i, p := range parts[1:] {
+		files = append(files, SplitFile{p.name, out[i+1]})
+	}
+	return r.withFrontMatter(fm, out[0]), files, nil
+}
+
+// splitName returns an unused file name for a section with the heading slug
+func splitName(slug string, used map[string]bool) string {
+	if slug == "" {
+		slug = "section"
+	}
+	name := slug + ".md"
+	for i := 1; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d.md", slug, i)
+	}
+	used[name] = true
+	return name
+}
+
+// rewriteSplitLinks rewrites the in-document links of each part, which refer
+// to the original anchors of headings, to the anchors of the headings in the
+// parts they were moved to. Links to another part's top heading point at its
+// file alone.
+func rewriteSplitLinks(parts []splitPart, anchors map[*blackfriday.Node]string, slug func(string) string) {
+	type target struct {
+		part   int
+		anchor string
+		top    bool // the heading of a section file
+	}
+	targets := map[string]target{}
+	for i, p := range parts {
+		for h, a := range headingAnchors(p.root.FirstChild, slug) {
+			if orig, ok := anchors[h]; ok {
+				targets[orig] = target{i, a, i > 0 && h == p.root.FirstChild}
+			}
+		}
+	}
+
+	for i, p := range parts {
+		walkType(p.root, blackfriday.Link, func(n *blackfriday.Node) {
+			dst := string(n.LinkData.Destination)
+			if !strings.HasPrefix(dst, "#") {
+				return
+			}
+			t, ok := targets[dst[1:]]
+			if !ok {
+				return
+			}
+			switch {
+			case t.part == i:
+				dst = "#" + t.anchor
+			case t.top:
+				dst = parts[t.part].name
+			default:
+				dst = parts[t.part].name + "#" + t.anchor
+			}
+			n.LinkData.Destination = []byte(dst)
+		})
+	}
+}
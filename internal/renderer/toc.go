@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/linewrap"
+)
+
+// Table of contents markers, which must be on a line of their own. The
+// source between them is replaced by a list of the document's headings.
+const (
+	TOCStart = "<!-- toc -->"
+	TOCStop  = "<!-- tocstop -->"
+)
+
+// DefaultTOCDepth is the deepest heading level listed in a table of contents
+// if Options.TOCDepth is not set
+const DefaultTOCDepth = 3
+
+// extractTOC replaces each table of contents in dat with a TOCStart
+// placeholder, which is rendered as a regenerated table of contents
+func extractTOC(dat []byte) []byte {
+	return collapseRegions(dat, func(line string) bool { return line == TOCStart }, TOCStop)
+}
+
+// toc emits a table of contents for the top level headings of the document
+// being rendered, as a nested list of links to their anchors between the
+// TOCStart and TOCStop markers. The list is parsed and rendered like any
+// other list, so it is formatted identically to the rest of the document.
+func (r *Renderer) toc(w *linewrap.Wrapper) error {
+	depth := r.opts.TOCDepth
+	if depth == 0 {
+		depth = DefaultTOCDepth
+	}
+
+	headings := []*blackfriday.Node{}
+	top := 0
+	for c := r.root; c != nil; c = c.Next {
+		if c.Type != blackfriday.Heading || c.HeadingData.Level > depth {
+			continue
+		}
+		if top == 0 || c.HeadingData.Level < top {
+			top = c.HeadingData.Level
+		}
+		headings = append(headings, c)
+	}
+
+	// each heading is nested under the previous one, by at most one level
+	var src strings.Builder
+	nest := -1
+	for _, h := range headings {
+		nest++
+		if l := h.HeadingData.Level - top; l < nest {
+			nest = l
+		}
+		fmt.Fprintf(&src, "%s- [%s](#%s)\n", strings.Repeat("   ", nest),
+			HeadingText(h), r.anchors[h])
+	}
+
+	w.Write([]byte(TOCStart))
+	w.Newline()
+	if len(headings) > 0 {
+		list, err := ParseMarkdown([]byte(src.String()))
+		if err != nil {
+			return err
+		}
+		w.BlankLine()
+		err = r.block(w, list.FirstChild)
+		if err != nil {
+			return err
+		}
+	}
+	w.BlankLine()
+	w.Write([]byte(TOCStop))
+	w.Newline()
+	return nil
+}
@@ -2,7 +2,11 @@ package renderer
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -82,3 +86,537 @@ func TestRender(t *testing.T) {
 		t.Error("invalid handling of nonexistant file")
 	}
 }
+
+func TestFrontMatter(t *testing.T) {
+	fm, rest := ParseFrontMatter([]byte("---\nb: 2\na: 'one'\nlist:\n  - x\n  - y\n---\n# Title\n"))
+	if fm == nil || fm.Format != YAML {
+		t.Fatal("yaml front matter not detected")
+	}
+	if string(rest) != "# Title\n" {
+		t.Error("front matter not split from body")
+	}
+	if fm.Meta["a"] != "one" || fm.Meta["b"] != "2" || fm.Meta["list"] != "- x\n- y" {
+		t.Errorf("invalid yaml metadata: %v", fm.Meta)
+	}
+	sorted := "---\na: 'one'\nb: 2\nlist:\n  - x\n  - y\n---\n"
+	if string(fm.Bytes(true)) != sorted {
+		t.Errorf("invalid sorted yaml front matter:\n%s", fm.Bytes(true))
+	}
+
+	fm, _ = ParseFrontMatter([]byte("+++\nz = 1\ny = \"two\"\n[t]\nb = 3\na = 4\n+++\n"))
+	if fm == nil || fm.Format != TOML {
+		t.Fatal("toml front matter not detected")
+	}
+	if fm.Meta["y"] != "two" || fm.Meta["t.a"] != "4" {
+		t.Errorf("invalid toml metadata: %v", fm.Meta)
+	}
+	sorted = "+++\ny = \"two\"\nz = 1\n[t]\na = 4\nb = 3\n+++\n"
+	if string(fm.Bytes(true)) != sorted {
+		t.Errorf("invalid sorted toml front matter:\n%s", fm.Bytes(true))
+	}
+
+	fm, rest = ParseFrontMatter([]byte("---\nno closing delimiter\n"))
+	if fm != nil || string(rest) != "---\nno closing delimiter\n" {
+		t.Error("unterminated front matter detected")
+	}
+
+	// a thematic break followed by a setext heading is not front matter
+	src := "---\n\nHeading\n---\n\nText.\n"
+	fm, rest = ParseFrontMatter([]byte(src))
+	if fm != nil || string(rest) != src {
+		t.Error("thematic break detected as front matter")
+	}
+
+	r := New(80)
+	out, err := r.RenderBytes([]byte("---\ntitle: x\n---\n"))
+	if err != nil || string(out) != "---\ntitle: x\n---\n" {
+		t.Error("front matter only document failed")
+	}
+	out, err = r.RenderBytes([]byte(src))
+	if err != nil || string(out) != "***\n\n## Heading\n\nText.\n" {
+		t.Errorf("invalid thematic break before setext heading:\n%s", out)
+	}
+}
+
+func TestHeadingIDs(t *testing.T) {
+	src := []byte("# Intro {#start}\n\n## Usage: vmdfmt\n\n## Usage: vmdfmt\n\n" +
+		"See [intro](#start) and [usage](#usage-vmdfmt-1).\n")
+
+	r := NewOptions(Options{Cols: 80, HeadingIDs: true, CheckAnchors: true})
+	out, err := r.RenderBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# Intro {#start}\n\n## Usage: vmdfmt {#usage-vmdfmt}\n\n" +
+		"## Usage: vmdfmt {#usage-vmdfmt-1}\n\n" +
+		"See [intro](#start) and [usage](#usage-vmdfmt-1).\n"
+	if string(out) != expected {
+		t.Errorf("invalid heading ids:\n%s", out)
+	}
+
+	r = NewOptions(Options{Cols: 80, CheckAnchors: true})
+	_, err = r.RenderBytes([]byte("# Renamed\n\nSee [intro](#intro).\n"))
+	if err == nil {
+		t.Error("broken anchor not detected")
+	}
+
+	if Slug("Hello, World! (v2.0)") != "hello-world-v20" {
+		t.Error("invalid slug")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	src := []byte("Title\n=====\n\n* one _two_\n\n\nSome __text__.\n\n~~~\ncode __x__\n~~~\n")
+	expected := []Normalization{
+		{Line: 1, Rule: RuleHeading, Message: "setext heading rewritten as ATX"},
+		{Line: 4, Rule: RuleBullet, Message: "'*' bullet rewritten as '-'"},
+		{Line: 4, Rule: RuleEmphasis, Message: "'_' emphasis rewritten as '*'"},
+		{Line: 6, Rule: RuleSpacing, Message: "consecutive blank lines collapsed"},
+		{Line: 7, Rule: RuleEmphasis, Message: "'__' strong emphasis rewritten as '**'"},
+		{Line: 9, Rule: RuleFence, Message: "tilde fence rewritten with backticks"},
+	}
+	changes := New(80).Explain(src)
+	if len(changes) != len(expected) {
+		t.Fatalf("invalid normalizations: %v", changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("invalid normalization: %v", changes[i])
+		}
+	}
+
+	// the indented paragraph makes the list loose
+	src = []byte("* a\n* b\n\n    code\n")
+	loose := Normalization{Line: 2, Rule: RuleSpacing, Message: "blank line added between list items"}
+	if n := New(80).Explain(src); len(n) != 3 || n[2] != loose {
+		t.Errorf("loose list not explained: %v", n)
+	}
+
+	src, err := ioutil.ReadFile("testfiles/README.md")
+	if err != nil {
+		t.Error("read error")
+	}
+	if len(New(80).Explain(src)) != 0 {
+		t.Error("normalizations reported for formatted file")
+	}
+}
+
+func TestExplainChanges(t *testing.T) {
+	sources := []string{
+		"Title\n=====\n\n* one _two_\n\n\n~~~\ncode __x__\n~~~\n",
+		"* a\n* b\n\n    code\n",
+		"Back in\n1999) we shipped it.\n\n2) two\n3) three\n",
+		"3. three\n3. four\n\n\n",
+		"Text\n***\n+ item  \n\n    code\n\nSub\n---\n## Closed ##\n",
+		"> quote\n> * item\n>\n> ~~~\n> code\n> ~~~\n",
+	}
+	for _, f := range append(verbatimFiles, columnFiles...) {
+		src, err := ioutil.ReadFile(filepath.Join(testPath, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(src))
+	}
+
+	// every run of lines changed by rendering is explained on its source
+	// lines, and nothing is explained on unchanged lines
+	r := New(40)
+	for _, src := range sources {
+		out, err := r.RenderBytes([]byte(src))
+		if err != nil {
+			continue
+		}
+		lines := sourceLines([]byte(src))
+		hunks := joinHunks(diffLines(lines, sourceLines(out)), lines)
+		changes := r.Explain([]byte(src))
+		for _, h := range hunks {
+			first, last := h.a0+1, h.a1
+			if h.a0 == h.a1 {
+				first, last = h.a0, h.a0+1
+			}
+			explained := false
+			for _, c := range changes {
+				explained = explained || (c.Line >= first && c.Line <= last)
+			}
+			if !explained {
+				t.Errorf("lines %d-%d of %q changed without explanation: %v", first, last, src, changes)
+			}
+		}
+		for _, c := range changes {
+			changed := false
+			for _, h := range hunks {
+				changed = changed || (c.Line >= h.a0 && c.Line <= h.a1+1)
+			}
+			if !changed {
+				t.Errorf("unchanged line of %q explained: %v", src, c)
+			}
+		}
+	}
+}
+
+func TestListNumbering(t *testing.T) {
+	src := []byte("3) three\n3) four\n3) five\n")
+
+	out, err := New(80).RenderBytes(src)
+	if err != nil || string(out) != "3. three\n4. four\n5. five\n" {
+		t.Errorf("invalid list numbering:\n%s", out)
+	}
+
+	r := NewOptions(Options{Cols: 80, ListDelimiter: ')', UniformNumbering: true})
+	out, err = r.RenderBytes(src)
+	if err != nil || string(out) != "3) three\n3) four\n3) five\n" {
+		t.Errorf("invalid uniform list numbering:\n%s", out)
+	}
+
+	// a number in paragraph text is not a list item
+	src = []byte("Back in\n1999) we shipped it.\n\n2) two\n3) three\n")
+	out, err = New(80).RenderBytes(src)
+	if err != nil || string(out) != "Back in 1999) we shipped it.\n\n2. two\n3. three\n" {
+		t.Errorf("invalid list numbering after paragraph (%v):\n%s", err, out)
+	}
+	if n := New(80).Explain(src); len(n) != 2 || n[0].Line != 4 {
+		t.Errorf("invalid list numbering explained: %v", n)
+	}
+
+	// list starts follow the block structure of the document
+	tests := []struct{ src, want string }{
+		{"Title\n=====\n3. a\n", "# Title\n\n3. a\n"},
+		{"Title\n-----\n3. a\n", "## Title\n\n3. a\n"},
+		{"| a |\n|---|\n| b |\n1. x\n", "| a |\n|---|\n| b |\n\n1. x\n"},
+		{"1. a\n\n   ## h\n\n2. b\n", "1. a\n\n## h\n\n2. b\n"},
+		{"1. a\n\n   para\n\n2. b\n   - x\n   - y\n", "1. a\n\npara\n\n2. b\n   - x\n   - y\n"},
+		{"1. a\n\n        3. code\n\n2. b\n", "1. a\n\n    ```\n    3. code\n    ```\n\n2. b\n"},
+		{"Para\n\n1.\n2. b\n", "Para\n\n1. 2. b\n"},
+		{"***\n3. a\n", "***\n\n3. a\n"},
+		{"> q\n```\n\n10. ten\n```\n\n3. a\n", "> q\n> \n> ```\n> \n> 10. ten\n> ```\n\n3. a\n"},
+	}
+	for _, test := range tests {
+		out, err := New(80).RenderBytes([]byte(test.src))
+		if err != nil || string(out) != test.want {
+			t.Errorf("invalid list numbering for %q (%v):\n%s", test.src, err, out)
+		}
+	}
+}
+
+func TestCallouts(t *testing.T) {
+	src := []byte("> [!DANGER]\n> Do not do this.\n")
+
+	_, err := New(80).RenderBytes(src)
+	if err == nil {
+		t.Error("invalid callout type accepted")
+	}
+
+	r := NewOptions(Options{Cols: 80, CalloutTypes: []string{"danger"}})
+	out, err := r.RenderBytes(src)
+	if err != nil || string(out) != string(src) {
+		t.Errorf("configured callout type failed:\n%s", out)
+	}
+}
+
+func TestIgnoreRegions(t *testing.T) {
+	src := []byte("Some   text.\n<!-- vmdfmt-off -->\n*   keep   this*\n<!-- vmdfmt-on -->\nMore   text.\n")
+	expected := "Some text.\n\n<!-- vmdfmt-off -->\n*   keep   this*\n<!-- vmdfmt-on -->\n\nMore text.\n"
+
+	r := New(80)
+	out, err := r.RenderBytes(src)
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid ignored region:\n%s", out)
+	}
+	if n := r.Explain(src); len(n) != 4 || n[1].Line != 1 || n[2].Line != 5 {
+		t.Errorf("normalizations reported in ignored region: %v", n)
+	}
+}
+
+func TestRenderRange(t *testing.T) {
+	src := []byte("---\ntitle: range\n---\n\n#  One  \n\nfirst   paragraph\n\n\n* a\n* b\n\nsecond   paragraph\n\n```\nkeep   this\n\n```\n\nlast   paragraph\n")
+	tests := []struct {
+		first, last int
+		expected    string
+	}{
+		{7, 7, "---\ntitle: range\n---\n\n#  One  \n\nfirst paragraph\n\n\n* a\n* b\n\nsecond   paragraph\n\n```\nkeep   this\n\n```\n\nlast   paragraph\n"},
+		{6, 10, "---\ntitle: range\n---\n\n#  One  \n\nfirst paragraph\n\n\n- a\n- b\n\nsecond   paragraph\n\n```\nkeep   this\n\n```\n\nlast   paragraph\n"},
+		{16, 16, string(src)},
+		{8, 9, string(src)},
+		{5, 20, "---\ntitle: range\n---\n\n# One\n\nfirst paragraph\n\n\n- a\n- b\n\nsecond paragraph\n\n```\nkeep   this\n\n```\n\nlast paragraph\n"},
+	}
+
+	r := New(80)
+	for _, test := range tests {
+		out, err := r.RenderRange(src, test.first, test.last)
+		if err != nil || string(out) != test.expected {
+			t.Errorf("invalid range %d:%d:\n%s", test.first, test.last, out)
+		}
+	}
+
+	out, err := r.RenderBytes(src)
+	if err != nil || bytes.Count(out, []byte("# One")) != 1 {
+		t.Errorf("renderer state kept between renders:\n%s", out)
+	}
+}
+
+func TestRewrites(t *testing.T) {
+	src := []byte("# The colour guide\n\n## Colours\n\nPick a colour from [the colour chart](http://old.example.com/colour.html) or\n`colour` ![colour](http://old.example.com/colour.png).\n")
+	expected := "## The color guide\n\n### Colours\n\nPick a color from [the color chart](https://example.com/colour.html) or `colour`\n![color](https://example.com/colour.png).\n"
+
+	rewrites := []Rewrite{}
+	for _, rule := range []string{"url:http://old.example.com/ -> https://example.com/", "heading:* -> +1", "text: colour -> color"} {
+		rw, err := ParseRewrite(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rewrites = append(rewrites, rw)
+	}
+
+	out, err := NewOptions(Options{Cols: 80, Rewrites: rewrites}).RenderBytes(src)
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid rewrite:\n%s", out)
+	}
+
+	for _, rule := range []string{"colour -> color", "link:a -> b", "heading:7 -> 1", "heading:1 -> h2", "text: -> x"} {
+		if _, err := ParseRewrite(rule); err == nil {
+			t.Errorf("invalid rule %q parsed", rule)
+		}
+	}
+}
+
+func TestTOC(t *testing.T) {
+	src := []byte("# Guide\n\n<!-- toc -->\n* stale entry\n<!-- tocstop -->\n\n## Getting  started\n\n" +
+		"### Install -- now\n\n#### Details\n\n## Usage\n\n```\n<!-- toc -->\n```\n")
+	expected := "# Guide\n\n<!-- toc -->\n\n- [Guide](#guide)\n   - [Getting started](#getting-started)\n" +
+		"      - [Install -- now](#install----now)\n   - [Usage](#usage)\n\n<!-- tocstop -->\n\n" +
+		"## Getting started\n\n### Install -- now\n\n#### Details\n\n## Usage\n\n```\n<!-- toc -->\n```\n"
+
+	out, err := NewOptions(Options{Cols: 80, CheckAnchors: true}).RenderBytes(src)
+	if err != nil || string(out) != expected {
+		t.Fatalf("invalid table of contents (%v):\n%s", err, out)
+	}
+	again, err := NewOptions(Options{Cols: 80}).RenderBytes(out)
+	if err != nil || string(again) != expected {
+		t.Errorf("table of contents not stable:\n%s", again)
+	}
+
+	out, err = NewOptions(Options{Cols: 80, TOCDepth: 2, AnchorStyle: AnchorGitLab}).RenderBytes(src)
+	if err != nil || !strings.Contains(string(out), "<!-- toc -->\n\n- [Guide](#guide)\n   - [Getting started](#getting-started)\n   - [Usage](#usage)\n\n<!-- tocstop -->\n") {
+		t.Errorf("invalid table of contents depth:\n%s", out)
+	}
+	if GitLabSlug("Install -- now") != "install-now" {
+		t.Error("invalid gitlab slug")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	parts := []Part{
+		{Title: "Handbook", Level: 1},
+		{Level: 2, Source: []byte("---\ntitle: a\n---\n# Setup\n\n## Usage {#usage}\n\nSee [usage](#usage).\n\n" +
+			"<!-- vmdfmt-off -->\nkeep   this\n<!-- vmdfmt-on -->\n")},
+		{Level: 2, Source: []byte("# Deploy\n\n## Usage {#usage}\n\n### Notes\n\nSee [usage](#usage) and [notes](#notes).\n\n" +
+			"<!-- vmdfmt-off -->\nand   this\n")},
+	}
+	expected := "# Handbook\n\n## Setup\n\n### Usage {#usage}\n\nSee [usage](#usage).\n\n" +
+		"<!-- vmdfmt-off -->\nkeep   this\n<!-- vmdfmt-on -->\n\n" +
+		"## Deploy\n\n### Usage {#usage-1}\n\n#### Notes\n\nSee [usage](#usage-1) and [notes](#notes).\n\n" +
+		"<!-- vmdfmt-off -->\nand   this\n"
+
+	out, err := NewOptions(Options{Cols: 80, CheckAnchors: true}).Compose(parts)
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid composition (%v):\n%s", err, out)
+	}
+
+	parts = []Part{
+		{Source: []byte("## Usage\n\nSee [usage](#usage).\n")},
+		{Source: []byte("## Usage\n\nSee [usage](#usage).\n")},
+	}
+	expected = "# Usage\n\nSee [usage](#usage).\n\n# Usage\n\nSee [usage](#usage-1).\n"
+	out, err = New(80).Compose(parts)
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid composition (%v):\n%s", err, out)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"snippets/install.md": "---\ntitle: install\n---\nRun   `make`.\n\n<!-- include: note.md -->\n",
+		"snippets/note.md":    "* a note\n",
+		"cycle.md":            "<!-- include: snippets/cycle.md -->\n",
+		"snippets/cycle.md":   "<!-- include: ../cycle.md -->\n",
+		"fenced.md":           "```\n<!-- include-end -->\n```\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, []byte(content), 0644)
+	}
+
+	src := []byte("# Readme\n\n<!-- include: snippets/install.md -->\nstale\n<!-- include-end -->\n")
+	expected := "# Readme\n\n<!-- include: snippets/install.md -->\n\nRun `make`.\n\n" +
+		"<!-- include: note.md -->\n\n- a note\n\n<!-- include-end -->\n\n<!-- include-end -->\n"
+
+	r := NewOptions(Options{Cols: 80, IncludeDir: dir})
+	out, err := r.RenderBytes(src)
+	if err != nil || string(out) != expected {
+		t.Fatalf("invalid include (%v):\n%s", err, out)
+	}
+	again, err := r.RenderBytes(out)
+	if err != nil || string(again) != expected {
+		t.Errorf("include not stable:\n%s", again)
+	}
+
+	if n := r.Explain(src); len(n) != 1 || n[0].Rule != RuleInclude || n[0].Line != 3 {
+		t.Errorf("stale include not explained: %v", n)
+	}
+	if n := r.Explain(out); len(n) != 0 {
+		t.Errorf("up to date include explained: %v", n)
+	}
+
+	src = []byte("<!-- include: fenced.md -->\n\nafter\n")
+	expected = "<!-- include: fenced.md -->\n\n```\n<!-- include-end -->\n```\n\n<!-- include-end -->\n\nafter\n"
+	out, err = r.RenderBytes(src)
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid fenced include (%v):\n%s", err, out)
+	}
+	again, err = r.RenderBytes(out)
+	if err != nil || string(again) != expected {
+		t.Errorf("fenced include not stable:\n%s", again)
+	}
+	if n := r.Explain(out); len(n) != 0 {
+		t.Errorf("up to date fenced include explained: %v", n)
+	}
+
+	_, err = r.RenderBytes([]byte("<!-- include: cycle.md -->\n"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("include cycle not detected: %v", err)
+	}
+	_, err = r.RenderBytes([]byte("<!-- include: missing.md -->\n"))
+	if err == nil {
+		t.Error("missing include not detected")
+	}
+
+	// files outside of the document's directory cannot be included
+	outside, err := ioutil.TempDir("", "vmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	secret := filepath.Join(outside, "secret.md")
+	ioutil.WriteFile(secret, []byte("secret\n"), 0644)
+
+	_, err = r.RenderBytes([]byte("<!-- include: " + filepath.ToSlash(secret) + " -->\n"))
+	if err == nil || !strings.Contains(err.Error(), "absolute path") {
+		t.Errorf("absolute include path accepted: %v", err)
+	}
+	nested := NewOptions(Options{Cols: 80, IncludeDir: filepath.Join(dir, "snippets")})
+	_, err = nested.RenderBytes([]byte("<!-- include: ../cycle.md -->\n"))
+	if err == nil || !strings.Contains(err.Error(), "outside of") {
+		t.Errorf("include path outside of the directory accepted: %v", err)
+	}
+	if os.Symlink(secret, filepath.Join(dir, "link.md")) == nil {
+		_, err = r.RenderBytes([]byte("<!-- include: link.md -->\n"))
+		if err == nil || !strings.Contains(err.Error(), "outside of") {
+			t.Errorf("include through a symbolic link accepted: %v", err)
+		}
+	}
+
+	parts := []Part{
+		{Source: []byte("<!-- include: snippets/note.md -->\n")},
+		{Source: []byte("<!-- include: note.md -->\n"), IncludeDir: filepath.Join(dir, "snippets")},
+	}
+	out, err = r.Compose(parts)
+	expected = "<!-- include: snippets/note.md -->\n\n- a note\n\n<!-- include-end -->\n\n" +
+		"<!-- include: note.md -->\n\n- a note\n\n<!-- include-end -->\n"
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid composed include (%v):\n%s", err, out)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	src := []byte("# Project\n\nIntro.\n\n## Changelog\n\n### 1.4.0\n\n- Added   extract.\n\n#### Fixes\n\n" +
+		"- Fixed a bug.\n\n### 1.3.0\n\n- Older.\n\n## 1.4.0\n\nNot the changelog.\n")
+
+	out, err := New(80).Extract(src, []string{"Changelog", "1.4.0"}, 0)
+	expected := "### 1.4.0\n\n- Added extract.\n\n#### Fixes\n\n- Fixed a bug.\n"
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid section (%v):\n%s", err, out)
+	}
+
+	out, err = New(80).Extract(src, []string{"Changelog", "1.3.0"}, 1)
+	expected = "# 1.3.0\n\n- Older.\n"
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid re-based section (%v):\n%s", err, out)
+	}
+
+	out, err = New(80).Extract(src, []string{"1.4.0"}, 0)
+	expected = "### 1.4.0\n\n- Added extract.\n\n#### Fixes\n\n- Fixed a bug.\n"
+	if err != nil || string(out) != expected {
+		t.Errorf("invalid first section (%v):\n%s", err, out)
+	}
+
+	_, err = New(80).Extract(src, []string{"Changelog", "2.0.0"}, 0)
+	if err == nil || err.Error() != `section "Changelog/2.0.0" not found` {
+		t.Errorf("missing section not reported: %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	src := []byte("---\ntitle: spec\n---\n# Spec\n\nSee [usage](#usage) and [notes](#notes-1).\n\n" +
+		"## Install\n\n### Notes\n\nThen read [usage](#usage).\n\n## Usage\n\n### Notes\n\nBack to [install](#install) " +
+		"or [notes](#notes-1).\n\n# Appendix\n\n## Usage\n")
+
+	index, files, err := New(80).Split(src, "spec.md", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "---\ntitle: spec\n---\n\n# Spec\n\nSee [usage](usage.md) and [notes](usage.md#notes).\n\n" +
+		"- [Install](install.md)\n- [Usage](usage.md)\n\n# Appendix\n\n- [Usage](usage-1.md)\n"
+	if string(index) != expected {
+		t.Errorf("invalid index:\n%s", index)
+	}
+
+	expectedFiles := []SplitFile{
+		{"install.md", []byte("# Install\n\n## Notes\n\nThen read [usage](usage.md).\n")},
+		{"usage.md", []byte("# Usage\n\n## Notes\n\nBack to [install](install.md) or [notes](#notes).\n")},
+		{"usage-1.md", []byte("# Usage\n")},
+	}
+	if len(files) != len(expectedFiles) {
+		t.Fatalf("invalid files: %v", files)
+	}
+	for i, f := range files {
+		if f.Name != expectedFiles[i].Name || !bytes.Equal(f.Content, expectedFiles[i].Content) {
+			t.Errorf("invalid file %s:\n%s", f.Name, f.Content)
+		}
+	}
+
+	_, _, err = New(80).Split(src, "spec.md", 4)
+	if err == nil {
+		t.Error("split without headings")
+	}
+}
+
+func TestBlockSpans(t *testing.T) {
+	body := []byte("# H\n- a\n\n- b\n\n1. one\n\n    more one\n\nTerm\n\n: Definition.\n\n    Second paragraph.\n\n" +
+		"    code\n\n    more code\n\n> q\n\n> q\n\ntext\n")
+	n, err := parseBody(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for c := n.FirstChild; c != nil; c = c.Next {
+		total++
+	}
+
+	lines := []int{}
+	nodes := []int{}
+	for _, s := range blockSpans(body, total) {
+		lines = append(lines, s.line)
+		nodes = append(nodes, s.nodes[1]-s.nodes[0])
+	}
+	if fmt.Sprint(lines) != "[0 1 5 9 19 23]" || fmt.Sprint(nodes) != "[1 1 1 1 1 1]" {
+		t.Errorf("invalid spans: lines %v, nodes %v", lines, nodes)
+	}
+}
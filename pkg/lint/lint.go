@@ -0,0 +1,273 @@
+// Package lint checks markdown documents against style rules which the
+// formatter cannot enforce by rewriting them, such as skipped heading levels
+// or duplicate headings. Rules are run over the parsed tree, and may be
+// enabled, disabled or given a severity by a Config. Rules which are Fixers
+// can also correct the issues they report, by rewriting the tree before it is
+// rendered.
+package lint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/renderer"
+	"github.com/bobertlo/vmd/pkg/mdformatter"
+)
+
+// Severity is the severity of an Issue
+type Severity int
+
+// Severities, from least to most severe. Rules which are Off are not run.
+const (
+	Off Severity = iota
+	Warning
+	Error
+)
+
+var severityNames = []string{"off", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < Off || s > Error {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses the name of a Severity ("off", "warning" or "error")
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if name == n {
+			return Severity(i), nil
+		}
+	}
+	return Off, fmt.Errorf("unknown severity %q", name)
+}
+
+// Issue is a problem found in a document by a Rule
+type Issue struct {
+	Line     int // line number in the source document, starting at 1
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%d: %s: %s [%s]", i.Line, i.Severity, i.Message, i.Rule)
+}
+
+// Document is a parsed markdown document, as passed to rules
+type Document struct {
+	Root   *blackfriday.Node
+	Source []byte
+	Cols   int // number of columns the document is formatted at
+
+	lines map[*blackfriday.Node]int
+}
+
+// Line returns the source line (counting from 1) of the top level block
+// containing n
+func (d *Document) Line(n *blackfriday.Node) int {
+	for n != nil && n.Parent != nil && n.Parent != d.Root {
+		n = n.Parent
+	}
+	return d.lines[n]
+}
+
+// Walk calls fn for every node of the document, in document order
+func (d *Document) Walk(fn func(n *blackfriday.Node)) {
+	d.Root.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering {
+			fn(n)
+		}
+		return blackfriday.GoToNext
+	})
+}
+
+// Rule checks a document, reporting each problem found with a message and
+// the node it was found at
+type Rule interface {
+	// Name identifies the rule in configuration and reports, i.e.
+	// "heading-increment"
+	Name() string
+	// Description is a short summary of what the rule checks
+	Description() string
+	Check(doc *Document, report func(n *blackfriday.Node, msg string))
+}
+
+// Fix is a rewrite of the tree which corrects an issue at Node
+type Fix struct {
+	Node    *blackfriday.Node
+	Message string // describes the fix, i.e. "changed h3 to h2"
+	Apply   func()
+}
+
+// Fixer is a Rule which can correct the issues it reports by rewriting the
+// tree, before the document is rendered
+type Fixer interface {
+	Rule
+	// Fixes returns the rewrites correcting the issues in doc, which are
+	// applied in order
+	Fixes(doc *Document) []Fix
+}
+
+// Config configures a Linter
+type Config struct {
+	// Cols is the number of columns documents are formatted at (default: 80)
+	Cols int
+	// Rules sets the severity of rules by name. Rules which are not listed
+	// are reported as warnings, and rules which are Off are not run.
+	Rules map[string]Severity
+}
+
+// ParseConfig reads a configuration file, which sets the severity of rules,
+// one per line as "rule = severity". Blank lines and lines starting with '#'
+// are ignored.
+func ParseConfig(r io.Reader) (Config, error) {
+	c := Config{Rules: map[string]Severity{}}
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		kv := strings.SplitN(text, "=", 2)
+		if len(kv) != 2 {
+			return c, fmt.Errorf("line %d: expected 'rule = severity'", line)
+		}
+		sev, err := ParseSeverity(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return c, fmt.Errorf("line %d: %s", line, err)
+		}
+		c.Rules[strings.TrimSpace(kv[0])] = sev
+	}
+	return c, s.Err()
+}
+
+// LoadConfig reads a configuration file with ParseConfig
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	return ParseConfig(f)
+}
+
+// Linter runs a set of rules over documents
+type Linter struct {
+	config Config
+	rules  []Rule
+}
+
+// New returns a Linter configured by config, which runs the built-in rules.
+// Rules named in config must be known to the Linter when Lint is called.
+func New(config Config) *Linter {
+	if config.Cols == 0 {
+		config.Cols = 80
+	}
+	l := &Linter{config: config}
+	for _, r := range Rules() {
+		l.Register(r)
+	}
+	return l
+}
+
+// Register adds a rule to the Linter
+func (l *Linter) Register(r Rule) {
+	l.rules = append(l.rules, r)
+}
+
+// Severity returns the configured severity of a rule
+func (l *Linter) Severity(rule string) Severity {
+	if s, ok := l.config.Rules[rule]; ok {
+		return s
+	}
+	return Warning
+}
+
+// checkConfig verifies that every rule named by the configuration is known
+func (l *Linter) checkConfig() error {
+	known := map[string]bool{}
+	for _, r := range l.rules {
+		known[r.Name()] = true
+	}
+	for name := range l.config.Rules {
+		if !known[name] {
+			return fmt.Errorf("unknown lint rule %q", name)
+		}
+	}
+	return nil
+}
+
+// Lint parses a markdown document and runs every enabled rule over it,
+// returning the issues found ordered by line
+func (l *Linter) Lint(dat []byte) ([]Issue, error) {
+	err := l.checkConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	root, lines, err := renderer.New(l.config.Cols).Parse(dat)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Root: root, Source: dat, Cols: l.config.Cols, lines: lines}
+
+	issues := []Issue{}
+	for _, r := range l.rules {
+		sev := l.Severity(r.Name())
+		if sev == Off {
+			continue
+		}
+		r.Check(doc, func(n *blackfriday.Node, msg string) {
+			issues = append(issues, Issue{doc.Line(n), r.Name(), sev, msg})
+		})
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+	return issues, nil
+}
+
+// Fix parses a markdown document, applies the fixes of every enabled rule
+// which is a Fixer, and renders the fixed document with opts. Returns the
+// output and an Issue describing each fix applied (in the order they were
+// applied), or an error.
+func (l *Linter) Fix(dat []byte, opts mdformatter.Options) ([]byte, []Issue, error) {
+	err := l.checkConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fixed := []Issue{}
+	rewrite := func(root *blackfriday.Node, lines map[*blackfriday.Node]int) error {
+		doc := &Document{Root: root, Source: dat, Cols: l.config.Cols, lines: lines}
+		for _, r := range l.rules {
+			f, ok := r.(Fixer)
+			sev := l.Severity(r.Name())
+			if !ok || sev == Off {
+				continue
+			}
+			for _, fix := range f.Fixes(doc) {
+				fix.Apply()
+				fixed = append(fixed, Issue{doc.Line(fix.Node), r.Name(), sev, fix.Message})
+			}
+		}
+		return nil
+	}
+
+	out, err := renderer.NewOptions(opts).RenderRewrite(dat, rewrite)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, fixed, nil
+}
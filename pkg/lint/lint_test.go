@@ -0,0 +1,136 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/pkg/mdformatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const doc = `---
+title: lint
+---
+
+# Title
+
+### Skipped:
+
+See http://example.com/docs. for details, or [nothing](#) and <https://example.com/>.
+
+## Usage
+
+| a | b |
+|---|---|
+| a long cell which makes the table rather wide | another long cell here |
+
+## Usage
+`
+
+func TestLint(t *testing.T) {
+	l := New(Config{Cols: 60})
+	issues, err := l.Lint([]byte(doc))
+	require.NoError(t, err)
+
+	expected := []string{
+		"7: warning: heading level skips from h1 to h3 [heading-increment]",
+		"7: warning: heading 'Skipped:' ends with punctuation [heading-punctuation]",
+		"9: warning: link has no destination [empty-link]",
+		"9: warning: bare URL http://example.com/docs should be a link: <http://example.com/docs> [bare-url]",
+		"13: warning: table is 74 columns wide, more than 60 [table-length]",
+		"17: warning: duplicate heading 'Usage' (first on line 11) [duplicate-heading]",
+	}
+	actual := []string{}
+	for _, i := range issues {
+		actual = append(actual, i.String())
+	}
+	assert.ElementsMatch(t, expected, actual)
+	for i := 1; i < len(issues); i++ {
+		assert.True(t, issues[i-1].Line <= issues[i].Line, "issues not ordered by line")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader("# severities\n\nbare-url = off\nduplicate-heading = error\n"))
+	require.NoError(t, err)
+	c.Cols = 80
+
+	issues, err := New(c).Lint([]byte(doc))
+	require.NoError(t, err)
+	for _, i := range issues {
+		assert.NotEqual(t, "bare-url", i.Rule)
+		assert.NotEqual(t, "table-length", i.Rule)
+		if i.Rule == "duplicate-heading" {
+			assert.Equal(t, Error, i.Severity)
+		} else {
+			assert.Equal(t, Warning, i.Severity)
+		}
+	}
+
+	_, err = ParseConfig(strings.NewReader("bare-url = loud\n"))
+	assert.Error(t, err)
+	_, err = ParseConfig(strings.NewReader("bare-url\n"))
+	assert.Error(t, err)
+
+	_, err = New(Config{Rules: map[string]Severity{"no-such-rule": Error}}).Lint([]byte(doc))
+	assert.Error(t, err)
+}
+
+// noEmphasis is a custom rule reporting every emphasis node
+type noEmphasis struct{}
+
+func (noEmphasis) Name() string        { return "no-emphasis" }
+func (noEmphasis) Description() string { return "emphasis is not used" }
+
+func (noEmphasis) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type == blackfriday.Emph {
+			report(n, "emphasis used")
+		}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	l := New(Config{Rules: map[string]Severity{"no-emphasis": Error}})
+	l.Register(noEmphasis{})
+	issues, err := l.Lint([]byte("# One\n\nsome *emphasis*\n"))
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, Issue{3, "no-emphasis", Error, "emphasis used"}, issues[0])
+}
+
+func TestFix(t *testing.T) {
+	src := "# Title\n\n### Details.\n\n#### More\n\n![](img/project_logo.png)\n\n```\nx\n\n\n\ny\n```\n\n1. one\n3. two\n   1. a\n   1. b\n"
+	l := New(Config{})
+
+	issues, err := l.Lint([]byte(src))
+	require.NoError(t, err)
+	rules := []string{}
+	for _, i := range issues {
+		rules = append(rules, i.Rule)
+	}
+	assert.Equal(t, []string{"heading-increment", "heading-punctuation", "image-alt", "code-blank-lines", "list-numbering"}, rules)
+
+	out, fixes, err := l.Fix([]byte(src), mdformatter.Options{Cols: 80})
+	require.NoError(t, err)
+	expected := []string{
+		"3: warning: changed h3 to h2 [heading-increment]",
+		"5: warning: changed h4 to h3 [heading-increment]",
+		"3: warning: removed '.' from the end of a heading [heading-punctuation]",
+		"9: warning: collapsed consecutive blank lines in a code block [code-blank-lines]",
+		"17: warning: renumbered ordered list [list-numbering]",
+		"7: warning: added alt text placeholder 'project logo' [image-alt]",
+	}
+	actual := []string{}
+	for _, f := range fixes {
+		actual = append(actual, f.String())
+	}
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, "# Title\n\n## Details\n\n### More\n\n![project logo](img/project_logo.png)\n\n```\nx\n\ny\n```\n\n1. one\n2. two\n   1. a\n   2. b\n", string(out))
+
+	issues, err = l.Lint(out)
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+}
@@ -0,0 +1,411 @@
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	blackfriday "github.com/bobertlo/blackfriday/v2"
+	"github.com/bobertlo/vmd/internal/renderer"
+)
+
+// Rules returns the built-in rules
+func Rules() []Rule {
+	return []Rule{
+		headingIncrement{},
+		duplicateHeading{},
+		headingPunctuation{},
+		emptyLink{},
+		bareURL{},
+		tableLength{},
+		codeBlankLines{},
+		listNumbering{},
+		imageAlt{},
+	}
+}
+
+// headingIncrement reports headings more than one level deeper than the
+// preceding heading
+type headingIncrement struct{}
+
+func (headingIncrement) Name() string { return "heading-increment" }
+
+func (headingIncrement) Description() string {
+	return "heading levels only increase by one at a time"
+}
+
+func (headingIncrement) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	prev := 0
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Heading {
+			return
+		}
+		level := n.HeadingData.Level
+		if prev > 0 && level > prev+1 {
+			report(n, fmt.Sprintf("heading level skips from h%d to h%d", prev, level))
+		}
+		prev = level
+	})
+}
+
+// Fixes lowers each skipping heading to one level below the preceding
+// heading, as it is after any earlier fixes
+func (headingIncrement) Fixes(doc *Document) []Fix {
+	fixes := []Fix{}
+	prev := 0
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Heading {
+			return
+		}
+		level := n.HeadingData.Level
+		if prev > 0 && level > prev+1 {
+			h, fixed := n, prev+1
+			fixes = append(fixes, Fix{n, fmt.Sprintf("changed h%d to h%d", level, fixed), func() {
+				h.HeadingData.Level = fixed
+			}})
+			level = fixed
+		}
+		prev = level
+	})
+	return fixes
+}
+
+// duplicateHeading reports headings with the same text as an earlier heading
+type duplicateHeading struct{}
+
+func (duplicateHeading) Name() string { return "duplicate-heading" }
+
+func (duplicateHeading) Description() string {
+	return "headings have unique text"
+}
+
+func (duplicateHeading) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	seen := map[string]int{}
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Heading {
+			return
+		}
+		text := renderer.HeadingText(n)
+		if line, ok := seen[text]; ok {
+			report(n, fmt.Sprintf("duplicate heading '%s' (first on line %d)", text, line))
+			return
+		}
+		seen[text] = doc.Line(n)
+	})
+}
+
+// headingPunctuation reports headings which end with punctuation
+type headingPunctuation struct{}
+
+const headingPunctuationChars = ".,;:!"
+
+func (headingPunctuation) Name() string { return "heading-punctuation" }
+
+func (headingPunctuation) Description() string {
+	return "headings do not end with punctuation (" + headingPunctuationChars + ")"
+}
+
+func (headingPunctuation) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Heading {
+			return
+		}
+		text := renderer.HeadingText(n)
+		if text != "" && strings.ContainsRune(headingPunctuationChars, rune(text[len(text)-1])) {
+			report(n, fmt.Sprintf("heading '%s' ends with punctuation", text))
+		}
+	})
+}
+
+// Fixes removes the trailing punctuation of headings ending with text
+func (headingPunctuation) Fixes(doc *Document) []Fix {
+	fixes := []Fix{}
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Heading {
+			return
+		}
+		last := n.LastChild
+		for last != nil && last.LastChild != nil {
+			last = last.LastChild
+		}
+		if last == nil || last.Type != blackfriday.Text {
+			return
+		}
+		text := bytes.TrimRight(last.Literal, " \t\n")
+		trimmed := bytes.TrimRight(text, headingPunctuationChars)
+		if len(trimmed) == len(text) {
+			return
+		}
+		fixes = append(fixes, Fix{n, fmt.Sprintf("removed '%s' from the end of a heading", text[len(trimmed):]), func() {
+			last.Literal = trimmed
+		}})
+	})
+	return fixes
+}
+
+// emptyLink reports links without text or a destination
+type emptyLink struct{}
+
+func (emptyLink) Name() string { return "empty-link" }
+
+func (emptyLink) Description() string {
+	return "links have text and a destination"
+}
+
+func (emptyLink) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Link {
+			return
+		}
+		dst := strings.TrimSpace(string(n.LinkData.Destination))
+		if dst == "" || dst == "#" {
+			report(n, "link has no destination")
+		} else if n.FirstChild == nil {
+			report(n, "link to "+dst+" has no text")
+		}
+	})
+}
+
+// bareURL reports URLs in text which are not written as links
+type bareURL struct{}
+
+var reBareURL = regexp.MustCompile(`\b(https?|ftp)://[^\s<>()]+`)
+
+func (bareURL) Name() string { return "bare-url" }
+
+func (bareURL) Description() string {
+	return "URLs are written as links (i.e. <http://example.com/>)"
+}
+
+func (bareURL) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Text || n.Parent == nil ||
+			n.Parent.Type == blackfriday.Link || n.Parent.Type == blackfriday.Image {
+			return
+		}
+		for _, url := range reBareURL.FindAllString(string(n.Literal), -1) {
+			url = strings.TrimRight(url, ".,;:!?")
+			report(n, "bare URL "+url+" should be a link: <"+url+">")
+		}
+	})
+}
+
+// tableLength reports tables which are formatted wider than the document
+// columns, as tables are not line wrapped
+type tableLength struct{}
+
+func (tableLength) Name() string { return "table-length" }
+
+func (tableLength) Description() string {
+	return "formatted tables fit in the line wrapping columns"
+}
+
+func (tableLength) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Table {
+			return
+		}
+
+		// each column is as wide as its longest cell, plus "| " and " "
+		widths := []int{}
+		n.Walk(func(c *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+			if !entering || c.Type != blackfriday.TableRow {
+				return blackfriday.GoToNext
+			}
+			i := 0
+			for cell := c.FirstChild; cell != nil; cell = cell.Next {
+				text := ""
+				if cell.FirstChild != nil {
+					text, _ = renderer.InlineText(cell.FirstChild)
+				}
+				if i == len(widths) {
+					widths = append(widths, 0)
+				}
+				if len(text) > widths[i] {
+					widths[i] = len(text)
+				}
+				i++
+			}
+			return blackfriday.SkipChildren
+		})
+
+		width := 1
+		for _, w := range widths {
+			width += w + 3
+		}
+		if width > doc.Cols {
+			report(n, fmt.Sprintf("table is %d columns wide, more than %d", width, doc.Cols))
+		}
+	})
+}
+
+// codeBlankLines reports code blocks containing consecutive blank lines
+type codeBlankLines struct{}
+
+var reBlankLines = regexp.MustCompile(`\n([ \t]*\n){2,}`)
+
+func (codeBlankLines) Name() string { return "code-blank-lines" }
+
+func (codeBlankLines) Description() string {
+	return "code blocks do not contain consecutive blank lines"
+}
+
+func (codeBlankLines) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type == blackfriday.CodeBlock && reBlankLines.Match(n.Literal) {
+			report(n, "code block contains consecutive blank lines")
+		}
+	})
+}
+
+// Fixes collapses consecutive blank lines in code blocks into one
+func (codeBlankLines) Fixes(doc *Document) []Fix {
+	fixes := []Fix{}
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type == blackfriday.CodeBlock && reBlankLines.Match(n.Literal) {
+			code := n
+			fixes = append(fixes, Fix{n, "collapsed consecutive blank lines in a code block", func() {
+				code.Literal = reBlankLines.ReplaceAll(code.Literal, []byte("\n\n"))
+			}})
+		}
+	})
+	return fixes
+}
+
+// listNumbering reports ordered lists which are neither numbered
+// sequentially nor with the same number for every item. The tree does not
+// record item numbers, so they are read from the source lines of top level
+// lists.
+type listNumbering struct{}
+
+var reOrderedItem = regexp.MustCompile(`^( *)([0-9]+)[.)] `)
+
+func (listNumbering) Name() string { return "list-numbering" }
+
+func (listNumbering) Description() string {
+	return "ordered lists are numbered sequentially, or every item with the same number"
+}
+
+// inconsistentLists returns the top level ordered lists of doc containing an
+// inconsistently numbered list (which may be a sublist)
+func (listNumbering) inconsistentLists(doc *Document) []*blackfriday.Node {
+	lists := []*blackfriday.Node{}
+	lines := strings.Split(string(doc.Source), "\n")
+	for n := doc.Root.FirstChild; n != nil; n = n.Next {
+		if n.Type != blackfriday.List || n.ListFlags&blackfriday.ListTypeOrdered == 0 {
+			continue
+		}
+		first, end := doc.Line(n), len(lines)
+		if n.Next != nil && doc.Line(n.Next) > first {
+			end = doc.Line(n.Next) - 1
+		}
+
+		// the numbers of the list at each indentation
+		numbers := map[int][]int{}
+		consistent := true
+		check := func(nums []int) {
+			sequential, same := true, true
+			for i := 1; i < len(nums); i++ {
+				sequential = sequential && nums[i] == nums[i-1]+1
+				same = same && nums[i] == nums[0]
+			}
+			consistent = consistent && (sequential || same)
+		}
+		for _, line := range lines[first-1 : end] {
+			m := reOrderedItem.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			indent := len(m[1])
+			for i, nums := range numbers {
+				if i > indent {
+					// a deeper list ended
+					check(nums)
+					delete(numbers, i)
+				}
+			}
+			num, _ := strconv.Atoi(m[2])
+			numbers[indent] = append(numbers[indent], num)
+		}
+		for _, nums := range numbers {
+			check(nums)
+		}
+		if !consistent {
+			lists = append(lists, n)
+		}
+	}
+	return lists
+}
+
+func (l listNumbering) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	for _, n := range l.inconsistentLists(doc) {
+		report(n, "ordered list is not numbered sequentially")
+	}
+}
+
+// Fixes renumbers inconsistently numbered lists. Rendering numbers every
+// list from its start number, so the tree is not changed.
+func (l listNumbering) Fixes(doc *Document) []Fix {
+	fixes := []Fix{}
+	for _, n := range l.inconsistentLists(doc) {
+		fixes = append(fixes, Fix{n, "renumbered ordered list", func() {}})
+	}
+	return fixes
+}
+
+// imageAlt reports images without alt text
+type imageAlt struct{}
+
+func (imageAlt) Name() string { return "image-alt" }
+
+func (imageAlt) Description() string {
+	return "images have alt text"
+}
+
+func (imageAlt) Check(doc *Document, report func(*blackfriday.Node, string)) {
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type == blackfriday.Image && altText(n) == "" {
+			report(n, "image "+string(n.LinkData.Destination)+" has no alt text")
+		}
+	})
+}
+
+// altText returns the alt text of an image node
+func altText(n *blackfriday.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.Next {
+		b.Write(c.Literal)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Fixes gives images without alt text a placeholder, made from their file
+// name, for the author to replace
+func (imageAlt) Fixes(doc *Document) []Fix {
+	fixes := []Fix{}
+	doc.Walk(func(n *blackfriday.Node) {
+		if n.Type != blackfriday.Image || altText(n) != "" {
+			return
+		}
+		name := path.Base(string(n.LinkData.Destination))
+		alt := strings.TrimSpace(strings.NewReplacer("-", " ", "_", " ").
+			Replace(strings.TrimSuffix(name, path.Ext(name))))
+		if alt == "" || alt == "." || alt == "/" {
+			alt = "image"
+		}
+
+		img := n
+		fixes = append(fixes, Fix{n, "added alt text placeholder '" + alt + "'", func() {
+			for img.FirstChild != nil {
+				img.FirstChild.Unlink()
+			}
+			text := blackfriday.NewNode(blackfriday.Text)
+			text.Literal = []byte(alt)
+			img.AppendChild(text)
+		}})
+	})
+	return fixes
+}
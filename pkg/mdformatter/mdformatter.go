@@ -9,11 +9,52 @@ type MDFormatter struct {
 	render *renderer.Renderer
 }
 
+// Options configures the output of an MDFormatter
+type Options = renderer.Options
+
+// FrontMatter is a YAML or TOML metadata block from the start of a document
+type FrontMatter = renderer.FrontMatter
+
+// Normalization describes a change made when formatting a document
+type Normalization = renderer.Normalization
+
+// Rewrite is a structured rewrite of the parsed tree, applied before it is
+// rendered
+type Rewrite = renderer.Rewrite
+
+// ParseRewrite parses a rewrite rule of the form "kind:pattern -> replacement"
+// for Options.Rewrites. The kinds are "url" (replaces the prefix of link and
+// image destinations), "heading" (changes or shifts heading levels, i.e.
+// "heading:* -> +1") and "text" (replaces a word outside of code).
+func ParseRewrite(rule string) (Rewrite, error) {
+	return renderer.ParseRewrite(rule)
+}
+
+// Part is a document to be combined with others by Compose
+type Part = renderer.Part
+
+// SplitFile is a section of a document written to its own file by Split
+type SplitFile = renderer.SplitFile
+
+// Heading anchor styles, for Options.AnchorStyle
+const (
+	AnchorGitHub = renderer.AnchorGitHub
+	AnchorGitLab = renderer.AnchorGitLab
+)
+
+// Rules lists the normalization rules which Explain reports, in order
+var Rules = renderer.Rules
+
 // New returns a new MDFormatter which wraps lines at a specified number
 // of columns
 func New(cols int) *MDFormatter {
+	return NewOptions(Options{Cols: cols})
+}
+
+// NewOptions returns a new MDFormatter configured by opts
+func NewOptions(opts Options) *MDFormatter {
 	f := &MDFormatter{}
-	f.render = renderer.New(cols)
+	f.render = renderer.NewOptions(opts)
 	return f
 }
 
@@ -22,3 +63,53 @@ func New(cols int) *MDFormatter {
 func (f *MDFormatter) RenderBytes(input []byte) ([]byte, error) {
 	return f.render.RenderBytes(input)
 }
+
+// RenderRange formats only the top level blocks of a markdown []byte slice
+// which intersect the lines first through last (counting from 1), leaving
+// every other line byte-for-byte identical. Returns ([]byte, nil) or
+// (nil, error)
+func (f *MDFormatter) RenderRange(input []byte, first, last int) ([]byte, error) {
+	return f.render.RenderRange(input, first, last)
+}
+
+// Compose concatenates markdown documents into one formatted document. The
+// headings of each Part are shifted to nest under its Title (if any) at its
+// Level, and in-document links follow headings whose anchors are renumbered
+// to stay unique. Returns ([]byte, nil) or (nil, error)
+func (f *MDFormatter) Compose(parts []Part) ([]byte, error) {
+	return f.render.Compose(parts)
+}
+
+// Extract formats the section of a markdown []byte slice under a heading path
+// (i.e. {"Changelog", "1.4.0"}): its heading, and every block up to the next
+// heading of the same or a higher level. Each heading of the path is looked
+// up in the section of the one before it. If level is not zero, headings are
+// shifted so the section heading is at level. Returns ([]byte, nil) or
+// (nil, error)
+func (f *MDFormatter) Extract(input []byte, path []string, level int) ([]byte, error) {
+	return f.render.Extract(input, path, level)
+}
+
+// Split cuts a markdown []byte slice (whose file name is name) at its top
+// level headings of level. Each section is formatted as a file named by a
+// slug of its heading, with its headings shifted so its own is at level 1, and
+// is replaced in the returned index by a link to its file. In-document links
+// are rewritten to point at the files their headings were moved to. Returns
+// (index, files, nil) or (nil, nil, error)
+func (f *MDFormatter) Split(input []byte, name string, level int) ([]byte, []SplitFile, error) {
+	return f.render.Split(input, name, level)
+}
+
+// FrontMatter returns the front matter block at the start of a markdown
+// []byte slice, or nil if there is none. The parsed top level keys are
+// available in the Meta map.
+func (f *MDFormatter) FrontMatter(input []byte) *FrontMatter {
+	fm, _ := renderer.ParseFrontMatter(input)
+	return fm
+}
+
+// Explain lists the normalizations (heading style, bullets, fences, emphasis
+// delimiters and spacing) which formatting applies to a markdown []byte slice
+func (f *MDFormatter) Explain(input []byte) []Normalization {
+	return f.render.Explain(input)
+}